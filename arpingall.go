@@ -1,178 +1,1053 @@
-package main
+// Package arpingall sends a gratuitous ARP for every IP on every interface to
+// the interface's default gateway, and an unsolicited neighbor advertisement
+// for every IPv6 address.
+package arpingall
 
 import (
-	"bufio"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-type Route struct {
-	Interface   string
-	Destination net.IP
-	Gateway     net.IP
+// Mode selects which kind of gratuitous ARP is sent.
+type Mode string
+
+const (
+	// ModeUpdate sends unsolicited ARP requests (arping -U). Supported by
+	// every arping.
+	ModeUpdate Mode = "update"
+
+	// ModeReply sends unsolicited ARP replies (arping -A), which some
+	// switches honor more reliably. iputils arping supports -A; Thomas
+	// Habets' arping does not.
+	ModeReply Mode = "reply"
+)
+
+// Family selects which address families are announced.
+type Family string
+
+const (
+	FamilyIPv4 Family = "4"    // gratuitous ARP only
+	FamilyIPv6 Family = "6"    // neighbor advertisements only
+	FamilyBoth Family = "both" // both
+)
+
+// ipv4 reports whether f includes IPv4.
+func (f Family) ipv4() bool { return f == FamilyIPv4 || f == FamilyBoth }
+
+// ipv6 reports whether f includes IPv6.
+func (f Family) ipv6() bool { return f == FamilyIPv6 || f == FamilyBoth }
+
+// SourceSelection selects which IPv4 addresses of an interface are announced
+// to each of its gateways.
+type SourceSelection string
+
+const (
+	// SourceAll announces every address. It is the default.
+	SourceAll SourceSelection = "all"
+	// SourceFirst announces only the first address listed on the subnet.
+	SourceFirst SourceSelection = "first"
+	// SourceLowest announces only the numerically lowest address on the
+	// subnet.
+	SourceLowest SourceSelection = "lowest"
+	// SourcePrefSrc announces only the preferred source of the route to
+	// the gateway, as the kernel would pick, or the first address if no
+	// route has one.
+	SourcePrefSrc SourceSelection = "prefsrc"
+)
+
+// Options configures AnnounceAll.
+type Options struct {
+	// Arping is the arping command to run. Defaults to "arping".
+	Arping string
+
+	// Ndsend is the command used to send unsolicited IPv6 neighbor
+	// advertisements. IPv6 addresses are skipped if it is empty.
+	Ndsend string
+
+	// Family selects IPv4, IPv6 or both. Defaults to FamilyIPv4.
+	Family Family
+
+	// Count is passed to arping as -c and applies to each source IP
+	// individually. It is the number of packets per arping invocation, so it
+	// is never multiplied by how many announcements run at once, but each
+	// retry sends Count more; see Result.PacketsSent. Defaults to 1.
+	Count int
+
+	// Mode selects requests or replies. Defaults to ModeUpdate.
+	Mode Mode
+
+	// Variant is the arping implementation, which decides its flags. It is
+	// detected from Arping if unknown.
+	Variant Variant
+
+	// Target, if set, is announced to instead of the default gateway. Only
+	// IPv4 addresses on the same subnet as Target are announced.
+	Target net.IP
+
+	// Broadcast announces IPv4 addresses to their subnet's broadcast address
+	// instead of the gateway, so that every host on the LAN relearns them.
+	// Target takes precedence.
+	Broadcast bool
+
+	// SourceSelection announces only one IPv4 address per interface and
+	// gateway, chosen as it says, instead of every address. Defaults to
+	// SourceAll. It is ignored with NoGateway.
+	SourceSelection SourceSelection
+
+	// PrefSrc is short for SourceSelection SourcePrefSrc.
+	PrefSrc bool
+
+	// BridgeMembers also sends each IPv4 announcement on a bridge out of
+	// every member port, from the bridge's MAC. Without Native it needs
+	// Habets' arping, which can set the sender MAC.
+	BridgeMembers bool
+
+	// OncePerSubnet sends the announcements for each subnet and gateway on
+	// only one interface, the one whose name sorts first, for interfaces
+	// sharing a segment. Link-local subnets are never taken to be shared.
+	OncePerSubnet bool
+
+	// NoGateway announces each address to itself, the classic gratuitous
+	// ARP, instead of to a gateway, so that addresses without a default
+	// route are announced too. Target, Broadcast and SourceSelection are
+	// ignored.
+	NoGateway bool
+
+	// QuietSkips logs skipped addresses only at debug level, however
+	// surprising the reason. They are still skipped and reported.
+	QuietSkips bool
+
+	// Strict makes an IPv4 address assigned to more than one interface an
+	// error instead of a warning, and an IPv4 address on an up interface
+	// that can't be announced, such as one without a default gateway, a
+	// failed Result instead of a skipped one (SkipUnannounceable). Addresses
+	// left out on purpose, like those of another family, duplicates or ones
+	// the options rule out, are still skipped (SkipDeliberate).
+	Strict bool
+
+	// RefreshNeighbors also announces IPv4 addresses to every complete
+	// entry in the ARP cache on their subnet, so that every host that had
+	// them cached relearns them. It is ignored when Target is set.
+	RefreshNeighbors bool
+
+	// AnnounceSource, if set, is announced as the sender instead of the
+	// interface's own address on the interface whose subnet contains it.
+	// It is for floating IPs that aren't assigned to the interface.
+	AnnounceSource net.IP
+
+	// FirstGatewayOnly announces each IPv4 address only to the gateway of
+	// its lowest-metric default route, not to every gateway with a default
+	// route on the interface, as with a redundant router pair.
+	FirstGatewayOnly bool
+
+	// Gateways maps interface names to the IPv4 gateway to announce to on
+	// them instead of the one found in the routes. Addresses whose subnet
+	// doesn't contain it are skipped.
+	Gateways map[string]net.IP
+
+	// AllowGateways, if set, are the only IPv4 addresses announced to.
+	// Announcements to any other gateway are skipped.
+	AllowGateways []net.IP
+
+	// Verify follows each IPv4 announcement that succeeded with an
+	// ordinary ARP request to the gateway, setting Result.Verified if it
+	// replies within Timeout. It needs arping, so it is ignored with Native.
+	Verify bool
+
+	// DAD first asks, as duplicate address detection, whether another host
+	// already has the source address of each IPv4 announcement, such as a
+	// VIP about to be taken over. If one replies the announcement isn't
+	// made; it fails with ErrAddressConflict and Result.Conflict set. It
+	// needs arping, so it is ignored with Native.
+	DAD bool
+
+	// NeighState records in Result.GatewayState the state of each
+	// announcement's gateway in the kernel's neighbor table afterwards,
+	// such as REACHABLE or STALE, as a quick sign of a healthy link. It is
+	// only supported on Linux. Without netlink, it falls back to the ARP
+	// cache in /proc/net/arp, where every IPv4 entry that is neither
+	// incomplete nor PERMANENT is just COMPLETE.
+	NeighState bool
+
+	// Sudo runs arping and ndsend with "sudo -n", for when this process
+	// lacks the privileges to send raw packets.
+	Sudo bool
+
+	// TargetMAC, if set, makes native announcements unicast to this MAC,
+	// as the Ethernet destination and the ARP target hardware address,
+	// for switches that only refresh on unicast ARP. TargetMACAuto uses the
+	// gateway's MAC from the ARP cache instead, broadcasting if it isn't
+	// there. Both need Native.
+	TargetMAC     net.HardwareAddr
+	TargetMACAuto bool
+
+	// ExtraArgs are added to every arping command line, before the target,
+	// for flags of forks or newer versions that Options doesn't cover.
+	ExtraArgs []string
+
+	// ArgsFunc, if set, is given the arping arguments of each IPv4
+	// announcement, after ExtraArgs, and returns the ones to run instead.
+	// Arguments without the interface and source flags are ignored, with a
+	// warning, since arping would then announce the wrong address.
+	ArgsFunc func(iface, source, gateway string, base []string) []string
+
+	// Native sends IPv4 announcements on a raw socket instead of running
+	// arping. It needs CAP_NET_RAW and only works on Linux.
+	Native bool
+
+	// SourceMAC, if set, is the sender hardware address of native
+	// announcements instead of the interface's own, for taking over the MAC
+	// of a failed host.
+	SourceMAC net.HardwareAddr
+
+	// DryRun logs each command instead of running it.
+	DryRun bool
+
+	// Timeout bounds how long each announcement may take. A command still
+	// running after Timeout is killed and recorded as failed. Zero means no
+	// limit. Note that arping takes about Count seconds.
+	Timeout time.Duration
+
+	// Parallel is how many announcements may run at once. Zero means one per
+	// announcement, up to 16.
+	Parallel int
+
+	// Retries is how many times a failed announcement is retried, running
+	// arping again with the same Count. Only failures of a command that ran
+	// are retried.
+	Retries int
+
+	// RetryBackoff is the wait before the first retry. It doubles for each
+	// retry after that.
+	RetryBackoff time.Duration
+
+	// Grace is how long an announcement already running may take to
+	// finish once ctx is cancelled. Zero stops it immediately.
+	Grace time.Duration
+
+	// Max caps the total number of announcements in a run, as a safety
+	// valve against flooding the network. The rest are returned as skipped.
+	// Zero means no cap.
+	Max int
+
+	// Interval is how long to wait between starting announcements, to
+	// spread out the broadcast traffic. With Parallel set to 1 it is the gap
+	// between one announcement finishing and the next starting.
+	Interval time.Duration
+
+	// Wait keeps looking for up to this long, every second, while there
+	// is nothing to announce, as at boot before interfaces are up and have
+	// their addresses and routes. Each run of Loop or Watch waits too.
+	Wait time.Duration
+
+	// RandomizeOrder sends the announcements in random order, and Jitter
+	// waits a random time up to it before the first, so that many hosts
+	// started together, e.g. after maintenance, don't announce in lockstep.
+	// Both are seeded with Seed, or if it is zero with the hostname and the
+	// time.
+	RandomizeOrder bool
+	Jitter         time.Duration
+	Seed           int64
+
+	// Filter selects which interfaces to announce on.
+	Filter Filter
+
+	// Routes is where routes are read from: RoutesAuto (the default),
+	// RoutesNetlink or RoutesProcfs.
+	Routes string
+
+	// Table restricts routes to one routing table id, e.g. TableMain. Zero
+	// uses routes from all tables, which only netlink reports.
+	Table int
+
+	// Cache, if set, keeps discovered interfaces and routes between runs.
+	// Watch uses one by default.
+	Cache *Cache
+
+	// Output receives the output of each command. Defaults to os.Stdout.
+	Output io.Writer
+
+	// Logger receives everything the package logs, such as skipped
+	// addresses and failed commands. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Stream copies each command's output and errors to Output as they are
+	// printed, each line prefixed with the interface name, rather than
+	// printing the output once the command exits. It needs a Runner that
+	// implements StreamRunner, as the default one does.
+	Stream bool
+
+	// ChangedOnly only announces the addresses that are new or changed
+	// since the last run, as recorded in StateFile, which each run updates.
+	// A missing or corrupt StateFile announces everything.
+	ChangedOnly bool
+	StateFile   string
+
+	// Runner runs arping and ndsend. Defaults to running them with os/exec.
+	Runner Runner
+
+	// OnResult, if set, is called with the Result of each announcement as
+	// soon as it is done, and with one for each address that was skipped,
+	// with Skipped set to why, or with Strict, Err for those it counts as
+	// failed. Calls never overlap, even when announcing in parallel, and the
+	// run waits for each to return.
+	OnResult func(Result)
 }
 
-type iface struct {
-	name string
-	mac  string
-	addr string
+// Result records the outcome of a single announcement. At most one of Err
+// and Skipped is set, so test Err first: an announcement made or tried has
+// no Skipped, and a skipped one has no Err. The exception is an IPv4
+// address that Options.Strict counts as failed rather than skipped, whose
+// Err matches ErrSkipped and says why, with Skipped left empty.
+type Result struct {
+	Interface    string
+	Via          string // bridge member it was sent on, with BridgeMembers
+	Addr         string
+	SourceIP     net.IP
+	Gateway      net.IP
+	Command      []string // nil for native announcements
+	Output       string   // what the command printed on stdout
+	Stderr       string   // what the command printed on stderr
+	Err          error
+	Duration     time.Duration // including any retries
+	Attempts     int           // 1 plus the retries
+	PacketsSent  int           // by all attempts: Count each, or 1 for ndsend
+	Skipped      string        // why it wasn't made, if it wasn't
+	Verified     bool          // the gateway replied afterwards, with Options.Verify
+	Conflict     bool          // another host has the source address, with Options.DAD
+	GatewayState string        // in the neighbor table afterwards, with Options.NeighState
 }
 
-// Parse IP in format
-func parseIP(str string) (net.IP, error) {
-	bytes, err := hex.DecodeString(str)
-	if err != nil {
-		return nil, err
+// Results holds the outcome of every announcement in a run.
+type Results []Result
+
+// Failed returns the results of the announcements that failed, including
+// the addresses Options.Strict counts as failed.
+func (rs Results) Failed() []Result {
+	var failed []Result
+	for _, r := range rs {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
 	}
-	if len(bytes) != net.IPv4len {
-		// TODO: IPv6 support
-		return nil, fmt.Errorf("only IPv4 is supported")
+	return failed
+}
+
+// Succeeded returns how many announcements succeeded.
+func (rs Results) Succeeded() int {
+	return rs.Attempted() - len(rs.Failed())
+}
+
+// Attempted returns how many announcements were made or tried, that is,
+// not skipped.
+func (rs Results) Attempted() int {
+	return len(rs) - len(rs.Skipped())
+}
+
+// PacketsSent returns how many packets the announcements sent in total.
+func (rs Results) PacketsSent() int {
+	total := 0
+	for _, r := range rs {
+		total += r.PacketsSent
+	}
+	return total
+}
+
+// Skipped returns the results of the announcements that were not made.
+func (rs Results) Skipped() []Result {
+	var skipped []Result
+	for _, r := range rs {
+		if r.Skipped != "" {
+			skipped = append(skipped, r)
+		}
 	}
-	bytes[0], bytes[1], bytes[2], bytes[3] = bytes[3], bytes[2], bytes[1], bytes[0]
-	return net.IP(bytes), nil
+	return skipped
 }
 
-func GetRoutes() ([]Route, error) {
-	file, err := os.Open("/proc/net/route")
+// AnnounceAll announces every address on every interface selected by
+// opts.Filter. A failed announcement is recorded in the returned Results and
+// does not stop the others, as is every address skipped, with why; the error
+// is only set if discovery fails.
+func AnnounceAll(opts Options) (Results, error) {
+	return AnnounceAllContext(context.Background(), opts)
+}
+
+// AnnounceAllContext is like AnnounceAll but stops when ctx is done, killing
+// any running command once opts.Grace has passed. It then returns the
+// results so far and ctx.Err().
+func AnnounceAllContext(ctx context.Context, opts Options) (Results, error) {
+	opts, err := prepare(opts)
 	if err != nil {
-		log.Print("Can't open route file: ", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	routes := []Route{}
+	opts = withVariant(ctx, opts)
 
-	scanner := bufio.NewReader(file)
-	lineNum := 0
-	for {
-		line, err := scanner.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
-			return nil, fmt.Errorf("wrong number of fields (expected at least 3, got %d): %s", len(fields), line)
+	return announceAll(ctx, opts, func() ([]announcement, []Planned, error) {
+		ifaces, routes, routes6, neighbors, err := discoverAll(opts)
+		if err != nil {
+			return nil, nil, err
 		}
-		lineNum++
-		if lineNum == 1 {
-			continue // skip header
+		return plan(opts, ifaces, routes, routes6, neighbors)
+	})
+}
+
+// announceAll is AnnounceAllContext with prepared opts, making the
+// announcements find discovers and plans.
+func announceAll(ctx context.Context, opts Options, find func() ([]announcement, []Planned, error)) (Results, error) {
+	anns, planned, err := awaitAnnouncements(ctx, opts, find)
+	if err != nil {
+		return nil, err
+	}
+	var unchanged []announcement
+	if opts.ChangedOnly {
+		anns, unchanged = splitUnchanged(anns, loadState(opts.StateFile, opts.Logger))
+	}
+	anns, capped := capAnnouncements(anns, opts.Max, opts.Logger)
+	var skipped Results
+	for _, p := range planned {
+		if p.Skip == "" {
+			continue
 		}
-		routes = append(routes, Route{})
-		route := &routes[len(routes)-1]
-		route.Interface = fields[0]
-		ip, err := parseIP(fields[1])
-		if err != nil {
-			return nil, err
+		r := Result{Interface: p.Interface, Via: p.Via, Addr: p.Addr, SourceIP: p.SourceIP, Gateway: p.Gateway, Skipped: p.Skip}
+		if opts.Strict && strictSkip(p) {
+			r.Err, r.Skipped = fmt.Errorf("%w: %s", ErrSkipped, p.Skip), ""
 		}
-		route.Destination = ip
-		ip, err = parseIP(fields[2])
-		if err != nil {
-			return nil, err
+		notify(opts, r)
+		skipped = append(skipped, r)
+	}
+
+	results := runAll(ctx, opts, anns)
+	results = append(results, skipped...)
+	results = append(results, skippedResults(opts, unchanged, skipUnchanged)...)
+	results = append(results, skippedResults(opts, capped, skipCapped)...)
+	if opts.ChangedOnly && !opts.DryRun {
+		if err := nextState(results).save(opts.StateFile); err != nil {
+			opts.Logger.Error("Can't save state file", "path", opts.StateFile, "err", err)
 		}
-		route.Gateway = ip
 	}
-	return routes, nil
+	return results, ctx.Err()
 }
 
-func getDefaultRoutes() map[string]net.IP {
-	routes, err := GetRoutes()
-	if err != nil {
-		fmt.Printf("ERROR: %v", err)
-		os.Exit(1)
+// skippedResults returns the results of anns, which were skipped for reason.
+func skippedResults(opts Options, anns []announcement, reason string) Results {
+	var results Results
+	for _, a := range anns {
+		r := a.result()
+		r.Skipped = reason
+		notify(opts, r)
+		results = append(results, r)
 	}
+	return results
+}
 
-	defaultRoutes := make(map[string]net.IP)
+// strictSkip reports whether p is an IPv4 address that Options.Strict counts
+// as failed instead of skipped: one that should have been announced but
+// couldn't be, rather than one left out on purpose.
+func strictSkip(p Planned) bool {
+	ip, _, err := net.ParseCIDR(p.Addr)
+	return err == nil && ip.To4() != nil && p.SkipKind == SkipUnannounceable
+}
 
-	for i := range routes {
-		zero := net.IP{0, 0, 0, 0}
-		if routes[i].Destination.Equal(zero) {
-			defaultRoutes[routes[i].Interface] = routes[i].Gateway
+// notify passes r to opts.OnResult, if set.
+func notify(opts Options, r Result) {
+	if opts.OnResult != nil {
+		opts.OnResult(r)
+	}
+}
+
+// prepare fills in the defaults of opts and checks it.
+func prepare(opts Options) (Options, error) {
+	if opts.Arping == "" {
+		opts.Arping = "arping"
+	}
+	if opts.Count == 0 {
+		opts.Count = 1
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Runner == nil {
+		opts.Runner = execRunner{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if onResult := opts.OnResult; onResult != nil {
+		// Serialize the calls from parallel announcements.
+		var mu sync.Mutex
+		opts.OnResult = func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			onResult(r)
 		}
 	}
+	if err := opts.Filter.check(); err != nil {
+		return opts, err
+	}
+	if opts.ChangedOnly && opts.StateFile == "" {
+		return opts, errors.New("announcing only changed addresses needs a state file")
+	}
+	if _, ok := opts.Runner.(StreamRunner); opts.Stream && !ok {
+		return opts, errors.New("streaming output needs a Runner that implements StreamRunner")
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = ModeUpdate
+	case ModeUpdate, ModeReply:
+	default:
+		return opts, fmt.Errorf("unknown mode %q", opts.Mode)
+	}
+	switch {
+	case opts.PrefSrc:
+		opts.SourceSelection = SourcePrefSrc
+	case opts.SourceSelection == "":
+		opts.SourceSelection = SourceAll
+	}
+	switch opts.SourceSelection {
+	case SourceAll, SourceFirst, SourceLowest, SourcePrefSrc:
+	default:
+		return opts, fmt.Errorf("unknown source selection %q", opts.SourceSelection)
+	}
+	switch opts.Family {
+	case "":
+		opts.Family = FamilyIPv4
+	case FamilyIPv4, FamilyIPv6, FamilyBoth:
+	default:
+		return opts, fmt.Errorf("unknown address family %q", opts.Family)
+	}
+	return opts, nil
+}
 
-	return defaultRoutes
+// withVariant detects opts.Variant if it is unknown and arping is used,
+// which it isn't for IPv6 alone.
+func withVariant(ctx context.Context, opts Options) Options {
+	if opts.Variant == VariantUnknown && !opts.Native && opts.Family.ipv4() {
+		opts.Variant = detectVariant(ctx, opts.Runner, opts.Arping)
+		if opts.Variant == VariantUnknown {
+			opts.Logger.Warn("Couldn't detect arping variant; assuming iputils", "arping", opts.Arping)
+			opts.Variant = VariantIputils
+		} else {
+			opts.Logger.Debug("Detected arping variant", "arping", opts.Arping, "variant", opts.Variant)
+		}
+	}
+	return opts
 }
 
-func localAddresses() ([]iface, error) {
-	var interfaceList []iface
+// discoverAll returns everything plan needs: the interfaces, the routes in
+// opts.Table and, if wanted, the ARP cache.
+func discoverAll(opts Options) ([]Interface, []Route, []Route, []Neighbor, error) {
+	ifaces, routes, routes6, err := discover(opts)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	routes, routes6 = filterTable(routes, opts.Table), filterTable(routes6, opts.Table)
+
+	var neighbors []Neighbor
+	if opts.RefreshNeighbors || (opts.Native && opts.TargetMACAuto) {
+		if neighbors, err = GetNeighbors(); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	return ifaces, routes, routes6, neighbors, nil
+}
 
-	ifaces, err := net.Interfaces()
+// discover returns the interfaces to announce on and the IPv4 and IPv6
+// routes, from opts.Cache if set.
+func discover(opts Options) ([]Interface, []Route, []Route, error) {
+	if opts.Cache != nil {
+		return opts.Cache.discover(opts.Filter, opts.Routes, opts.Logger)
+	}
+	routes, routes6, err := loadRoutes(opts.Routes, opts.Logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ifaces, err := interfaces(opts.Filter, opts.Logger)
 	if err != nil {
-		log.Print(fmt.Errorf("localAddresses: %v\n", err.Error()))
-		return interfaceList, err
+		return nil, nil, nil, fmt.Errorf("getting interfaces: %w", err)
 	}
+	return ifaces, routes, routes6, nil
+}
 
-	for _, i := range ifaces {
-		// Skip interfaces that don't have a MAC address
-		if i.HardwareAddr.String() == "" {
-			continue
+// skipCapped is why announcements over Options.Max are skipped.
+const skipCapped = "over the announcement cap"
+
+// capAnnouncements splits anns into the first max, or all if max is zero, and
+// the rest.
+func capAnnouncements(anns []announcement, max int, logger *slog.Logger) (kept, capped []announcement) {
+	if max <= 0 || len(anns) <= max {
+		return anns, nil
+	}
+	logger.Warn("Skipping announcements over the cap", "max", max, "skipped", len(anns)-max)
+	return anns[:max], anns[max:]
+}
+
+// maxParallel caps the default number of concurrent announcements.
+const maxParallel = 16
+
+// command returns the command line that announces a.
+func (a announcement) command(opts Options) (string, []string) {
+	if a.source.To4() == nil {
+		// ndsend sends an unsolicited neighbor advertisement, the IPv6
+		// equivalent of a gratuitous ARP, to all nodes on the link.
+		return opts.Ndsend, []string{a.source.String(), a.iface.Name}
+	}
+
+	//                   IFACE   SOURCE     GATEWAY
+	// arping -U -c 1 -I eth0 -s 69.162.98.2 69.162.98.1
+	//
+	// 2: eth0:
+	//    link/ether 00:27:0e:09:7f:63 brd ff:ff:ff:ff:ff:ff
+	//    inet 69.162.98.2/24 brd 69.162.98.255 scope global eth0
+	//
+	// Who has 69.162.98.1? Tell 69.162.98.2
+	// - Sender MAC: 00:27:0e:09:7f:63 (eth0)  <- me
+	// - Sender IP: 69.162.98.2                <- me
+	// - Target MAC: ff:ff:ff:ff:ff:ff         <- everybody
+	// - Target IP: 69.162.98.1                <- gateway
+	//
+	// Asking everybody who has the gateway's IP address causes everbody to see
+	// who asked it and thus everybody learns that MAC/IP go together.
+	iface := a.iface.Name
+	if a.via != "" {
+		// Out of the bridge member, but from the bridge's MAC, which only
+		// Habets' arping can set.
+		iface = a.via
+	}
+	args := arpingArgs(opts.Variant, opts.Mode, strconv.Itoa(opts.Count), iface, a.source.String(), a.gateway.String())
+	if a.via != "" {
+		args = append([]string{"-s", a.iface.MAC}, args...)
+	}
+	if len(opts.ExtraArgs) > 0 {
+		last := len(args) - 1
+		args = append(append(append([]string(nil), args[:last]...), opts.ExtraArgs...), args[last])
+	}
+	if opts.ArgsFunc != nil {
+		custom := opts.ArgsFunc(iface, a.source.String(), a.gateway.String(), append([]string(nil), args...))
+		if keepsRequired(opts.Variant, args, custom) {
+			args = custom
+		} else {
+			opts.Logger.Warn("Ignoring ArgsFunc result without the interface and source arguments", "iface", iface, "args", strings.Join(custom, " "))
 		}
+	}
+	return opts.Arping, args
+}
 
-		addrs, err := i.Addrs()
-		if err != nil {
-			log.Print(fmt.Errorf("localAddresses: %v\n", err.Error()))
-			continue
+// keepsRequired reports whether args still has the interface and source
+// flags of base, with the same values.
+func keepsRequired(v Variant, base, args []string) bool {
+	required := []string{"-I", "-s"}
+	if v == VariantHabets {
+		required = []string{"-i", "-S"}
+	}
+	for _, flag := range required {
+		value := ""
+		for i := 0; i+1 < len(base); i++ {
+			if base[i] == flag {
+				value = base[i+1]
+			}
+		}
+		found := false
+		for i := 0; i+1 < len(args); i++ {
+			if args[i] == flag && args[i+1] == value {
+				found = true
+			}
+		}
+		if !found {
+			return false
 		}
+	}
+	return true
+}
 
-		for _, a := range addrs {
-			i := iface{name: i.Name, mac: i.HardwareAddr.String(), addr: a.String()}
-			interfaceList = append(interfaceList, i)
+// runAll runs anns on a pool of opts.Parallel workers, stopping dispatch when
+// ctx is done. Results are in the same order as anns, unless shuffled with
+// opts.RandomizeOrder, and only cover the announcements that were started.
+func runAll(ctx context.Context, opts Options, anns []announcement) Results {
+	if opts.RandomizeOrder || opts.Jitter > 0 {
+		rng := newRand(opts.Seed)
+		if opts.RandomizeOrder {
+			anns = shuffled(anns, rng)
 		}
+		if opts.Jitter > 0 && len(anns) > 0 && !opts.DryRun {
+			wait := time.Duration(rng.Int63n(int64(opts.Jitter)))
+			opts.Logger.Debug("Waiting before the first announcement", "jitter", wait)
+			if !sleep(ctx, wait) {
+				return nil
+			}
+		}
+	}
+
+	workers := opts.Parallel
+	if workers <= 0 {
+		workers = min(len(anns), maxParallel)
+	}
+
+	if workers == 1 {
+		return runSequential(ctx, opts, anns)
 	}
 
-	return interfaceList, nil
+	results := make(Results, len(anns))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				results[n] = announce(ctx, opts, anns[n])
+				notify(opts, results[n])
+			}
+		}()
+	}
+
+	started := 0
+dispatch:
+	for n := range anns {
+		if ctx.Err() != nil {
+			break
+		}
+		if n > 0 && !sleep(ctx, opts.Interval) {
+			break
+		}
+		select {
+		case jobs <- n:
+			started++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results[:started]
 }
 
-func main() {
-	defaultRoutes := getDefaultRoutes()
+// runSequential runs anns one after another, waiting opts.Interval between
+// the end of one and the start of the next.
+func runSequential(ctx context.Context, opts Options, anns []announcement) Results {
+	var results Results
+	for n, a := range anns {
+		if ctx.Err() != nil {
+			break
+		}
+		if n > 0 && !sleep(ctx, opts.Interval) {
+			break
+		}
+		r := announce(ctx, opts, a)
+		notify(opts, r)
+		results = append(results, r)
+	}
+	return results
+}
 
-	ifaces, err := localAddresses()
+// sleep waits for d, returning false early if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// result returns a Result describing a, before it is sent.
+func (a announcement) result() Result {
+	return Result{
+		Interface: a.iface.Name,
+		Via:       a.via,
+		Addr:      a.addr,
+		SourceIP:  a.source,
+		Gateway:   a.gateway,
+	}
+}
+
+// announce announces a, retrying transient failures up to opts.Retries times
+// with exponential backoff.
+func announce(ctx context.Context, opts Options, a announcement) Result {
+	start := time.Now()
+	if opts.DAD && !opts.DryRun && !opts.Native && a.source.To4() != nil {
+		if conflict, err := detectConflict(ctx, opts, a); conflict || err != nil {
+			r := a.result()
+			r.Conflict = conflict
+			r.Err = err
+			r.Duration = time.Since(start)
+			return r
+		}
+	}
+	backoff := opts.RetryBackoff
+	var r Result
+	for attempt := 1; ; attempt++ {
+		r = announceOnce(ctx, opts, a)
+		r.Attempts = attempt
+		if attempt > opts.Retries || !retryable(r.Err) {
+			break
+		}
+		opts.Logger.Warn("Retrying announcement", "iface", a.iface.Name, "source", a.source, "attempt", attempt+1, "count", opts.Count, "backoff", backoff, "err", r.Err)
+		if !sleep(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	if !opts.DryRun {
+		perAttempt := opts.Count
+		if a.source.To4() == nil {
+			perAttempt = 1 // ndsend has no count
+		}
+		r.PacketsSent = perAttempt * r.Attempts
+	}
+	if opts.Verify && r.Err == nil && !opts.DryRun && !opts.Native && a.source.To4() != nil {
+		r.Verified = verify(ctx, opts, a)
+	}
+	if opts.NeighState && !opts.DryRun {
+		r.GatewayState = gatewayState(opts, a)
+	}
+	r.Duration = time.Since(start)
+	return r
+}
+
+// verify sends an ARP request for a's gateway and reports whether it replied.
+func verify(ctx context.Context, opts Options, a announcement) bool {
+	name, args := opts.Arping, verifyArgs(opts.Variant, a.iface.Name, a.source.String(), a.gateway.String())
+	if opts.Sudo {
+		name, args = "sudo", append([]string{"-n", name}, args...)
+	}
+	runCtx, cancel := withTimeout(ctx, opts.Timeout, opts.Grace)
+	defer cancel()
+	_, _, err := opts.Runner.Run(runCtx, name, args...)
 	if err != nil {
-		log.Printf("Error getting interfaces: %s", err.Error())
-		os.Exit(1)
+		opts.Logger.Warn("Gateway didn't reply after announcement", "iface", a.iface.Name, "source", a.source, "gateway", a.gateway, "err", err)
+		return false
 	}
+	opts.Logger.Debug("Gateway replied after announcement", "iface", a.iface.Name, "source", a.source, "gateway", a.gateway)
+	return true
+}
 
-	for _, i := range ifaces {
-		ip, _, _ := net.ParseCIDR(i.addr)
-		if ip.To4() == nil {
-			log.Printf("Skipping non-IPv4 address: %s\n", i.addr)
-			continue
+// gatewayState returns the neighbor state of a's gateway on its interface,
+// or "" if it can't be read.
+func gatewayState(opts Options, a announcement) string {
+	index := a.iface.Index
+	if index == 0 {
+		ifi, err := net.InterfaceByName(a.iface.Name)
+		if err != nil {
+			opts.Logger.Warn("Can't read the gateway's neighbor state", "iface", a.iface.Name, "err", err)
+			return ""
 		}
+		index = ifi.Index
+	}
+	state, err := neighborState(index, a.iface.Name, a.gateway, opts.Logger)
+	if err != nil {
+		opts.Logger.Warn("Can't read the gateway's neighbor state", "iface", a.iface.Name, "gateway", a.gateway, "err", err)
+		return ""
+	}
+	opts.Logger.Debug("Gateway neighbor state", "iface", a.iface.Name, "gateway", a.gateway, "state", state)
+	return state
+}
 
-		gw := defaultRoutes[i.name]
-		if gw == nil {
-			log.Printf("Skipping IP because couldn't find default gateway for its interface: %s (iface: %s)\n", i.addr, i.name)
-			continue
+// detectConflict asks whether another host has a's source address. It
+// returns true and ErrAddressConflict if one replied.
+func detectConflict(ctx context.Context, opts Options, a announcement) (bool, error) {
+	iface := a.iface.Name
+	if a.via != "" {
+		iface = a.via
+	}
+	name, args := opts.Arping, dadArgs(opts.Variant, iface, a.source.String())
+	if opts.Sudo {
+		name, args = "sudo", append([]string{"-n", name}, args...)
+	}
+	runCtx, cancel := withTimeout(ctx, opts.Timeout, opts.Grace)
+	defer cancel()
+	output, stderr, err := opts.Runner.Run(runCtx, name, args...)
+	conflict, ok := dadConflict(opts.Variant, string(output))
+	switch {
+	case !ok && err != nil:
+		err = commandError(timeoutError(ctx, runCtx, opts.Timeout, err), stderr)
+		opts.Logger.Error("Error detecting duplicate address", "iface", iface, "source", a.source, "err", err)
+		return false, fmt.Errorf("duplicate address detection: %w", err)
+	case !ok:
+		opts.Logger.Warn("Can't tell from arping's output whether the address is in use; announcing anyway", "iface", iface, "source", a.source)
+	case conflict:
+		opts.Logger.Error("Another host has the address; not announcing it", "iface", iface, "source", a.source)
+		return true, fmt.Errorf("%w: %s", ErrAddressConflict, a.source)
+	default:
+		opts.Logger.Debug("No other host has the address", "iface", iface, "source", a.source)
+	}
+	return false, nil
+}
+
+// retryable reports whether err is a transient failure worth retrying: the
+// command ran and failed, rather than being impossible to run at all.
+func retryable(err error) bool {
+	var failed *ErrArpingFailed
+	var execErr *exec.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, ErrArpingNotFound):
+		return false
+	case errors.As(err, &failed):
+		return !misconfigured(failed.Stderr)
+	case errors.As(err, &execErr):
+		return false // not executable
+	}
+	return true
+}
+
+// gatewayAllowed reports whether opts allow announcing to gw.
+func gatewayAllowed(opts Options, gw net.IP) bool {
+	if len(opts.AllowGateways) == 0 {
+		return true
+	}
+	for _, ip := range opts.AllowGateways {
+		if ip.Equal(gw) {
+			return true
 		}
+	}
+	return false
+}
 
-		//                   IFACE   SOURCE     GATEWAY
-		// arping -U -c 1 -I eth0 -s 69.162.98.2 69.162.98.1
-		//
-		// 2: eth0:
-		//    link/ether 00:27:0e:09:7f:63 brd ff:ff:ff:ff:ff:ff
-		//    inet 69.162.98.2/24 brd 69.162.98.255 scope global eth0
-		//
-		// Who has 69.162.98.1? Tell 69.162.98.2
-		// - Sender MAC: 00:27:0e:09:7f:63 (eth0)  <- me
-		// - Sender IP: 69.162.98.2                <- me
-		// - Target MAC: ff:ff:ff:ff:ff:ff         <- everybody
-		// - Target IP: 69.162.98.1                <- gateway
-		//
-		// Asking everybody who has the gateway's IP address causes everbody to see
-		// who asked it and thus everybody learns that MAC/IP go together.
-		log.Printf("Executing: arping -U -c 1 -I %s -s %s %s\n", i.name, ip, gw.String())
-
-		args := []string{"-U", "-c", "1", "-I", i.name, "-s", ip.String(), gw.String()}
-		output, err := exec.Command("arping", args...).Output()
-		if err != nil {
-			log.Printf("Error running command: %s", err.Error())
-			os.Exit(1)
+// misconfigured reports whether arping's stderr says it was given an
+// interface that doesn't exist, which no retry will fix.
+func misconfigured(stderr string) bool {
+	for _, s := range []string{"unknown iface", "No such device", "not available"} {
+		if strings.Contains(stderr, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// announceOnce runs the command for a, or only logs it in dry-run mode.
+func announceOnce(ctx context.Context, opts Options, a announcement) Result {
+	if opts.Native && a.source.To4() != nil {
+		return announceNative(ctx, opts, a)
+	}
+
+	r := a.result()
+	name, args := a.command(opts)
+	if opts.Sudo {
+		name, args = "sudo", append([]string{"-n", name}, args...)
+	}
+	r.Command = append([]string{name}, args...)
+	cmdline := strings.Join(r.Command, " ")
+	if opts.DryRun {
+		opts.Logger.Info("Would execute", "iface", a.iface.Name, "command", cmdline)
+		return r
+	}
+
+	opts.Logger.Debug("Executing", "iface", a.iface.Name, "command", cmdline)
+	runCtx, cancel := withTimeout(ctx, opts.Timeout, opts.Grace)
+	defer cancel()
+	start := time.Now()
+	var output, stderr []byte
+	var err error
+	if opts.Stream {
+		w := &prefixWriter{w: opts.Output, prefix: a.iface.Name + ": "}
+		output, stderr, err = opts.Runner.(StreamRunner).RunStream(runCtx, w, name, args...)
+		w.Flush()
+	} else {
+		output, stderr, err = opts.Runner.Run(runCtx, name, args...)
+	}
+	r.Duration = time.Since(start)
+	err = commandError(timeoutError(ctx, runCtx, opts.Timeout, err), stderr)
+	r.Output = string(output)
+	r.Stderr = string(stderr)
+	r.Err = err
+	if err != nil {
+		opts.Logger.Error("Error running command", "iface", a.iface.Name, "command", cmdline, "err", err)
+	} else {
+		if len(stderr) > 0 {
+			opts.Logger.Debug("Command wrote to stderr", "iface", a.iface.Name, "command", cmdline, "stderr", strings.TrimSpace(r.Stderr))
+		}
+		if !opts.Stream {
+			fmt.Fprintln(opts.Output, string(output))
 		}
-		fmt.Println(string(output))
 	}
+	return r
+}
+
+// announceNative is like announce but sends the ARPs itself.
+func announceNative(ctx context.Context, opts Options, a announcement) Result {
+	r := a.result()
+	if opts.DryRun {
+		opts.Logger.Info("Would send native gratuitous ARP", "iface", a.iface.Name, "source", a.source, "gateway", a.gateway, "count", opts.Count, "target_mac", targetMACString(a.targetMAC))
+		return r
+	}
+
+	opts.Logger.Debug("Sending native gratuitous ARP", "iface", a.iface.Name, "source", a.source, "gateway", a.gateway, "count", opts.Count)
+	op := uint16(arpRequest)
+	if opts.Mode == ModeReply {
+		op = arpReply
+	}
+	runCtx, cancel := withTimeout(ctx, opts.Timeout, opts.Grace)
+	defer cancel()
+	start := time.Now()
+	r.Err = sendNative(runCtx, a, op, opts.Count, opts.SourceMAC)
+	r.Duration = time.Since(start)
+	r.Err = timeoutError(ctx, runCtx, opts.Timeout, r.Err)
+	if r.Err != nil {
+		opts.Logger.Error("Error sending ARP", "iface", a.iface.Name, "err", r.Err)
+	}
+	return r
+}
+
+// targetMACString describes the destination of a native announcement.
+func targetMACString(mac net.HardwareAddr) string {
+	if mac == nil {
+		return "broadcast"
+	}
+	return mac.String()
+}
+
+// withTimeout returns a context for running one announcement: ctx bounded by
+// timeout, unless timeout is zero, and outliving ctx by grace so that a
+// cancelled run lets announcements already started finish.
+func withTimeout(ctx context.Context, timeout, grace time.Duration) (context.Context, context.CancelFunc) {
+	parent, cancelParent := ctx, context.CancelFunc(func() {})
+	if grace > 0 {
+		var cancel context.CancelFunc
+		parent, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		stop := context.AfterFunc(ctx, func() {
+			t := time.AfterFunc(grace, cancel)
+			context.AfterFunc(parent, func() { t.Stop() })
+		})
+		cancelParent = func() {
+			stop()
+			cancel()
+		}
+	}
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(parent)
+	}
+	return runCtx, func() {
+		cancel()
+		cancelParent()
+	}
+}
+
+// timeoutError replaces err with a timeout error if runCtx, derived from ctx,
+// hit its deadline while ctx itself is still live.
+func timeoutError(ctx, runCtx context.Context, timeout time.Duration, err error) error {
+	if err != nil && ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
 }
@@ -0,0 +1,716 @@
+package arpingall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// threeInterfaces are eth0 to eth2, each with an address and a default
+// route.
+var threeInterfaces = []Interface{
+	ethernet(2, "eth0", "192.0.2.10/24"),
+	ethernet(3, "eth1", "198.51.100.7/24"),
+	ethernet(4, "eth2", "203.0.113.5/24"),
+}
+
+var threeRoutes = []Route{
+	defaultRoute("eth0", "192.0.2.1", 0),
+	defaultRoute("eth1", "198.51.100.1", 0),
+	defaultRoute("eth2", "203.0.113.1", 0),
+}
+
+// manyInterfaces returns n interfaces, each with an address and a default
+// route.
+func manyInterfaces(n int) ([]Interface, []Route) {
+	var ifaces []Interface
+	var routes []Route
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("eth%d", i)
+		ifaces = append(ifaces, ethernet(i+2, name, fmt.Sprintf("10.0.%d.2/24", i)))
+		routes = append(routes, defaultRoute(name, fmt.Sprintf("10.0.%d.1", i), 0))
+	}
+	return ifaces, routes
+}
+
+// failOn returns a fakeRunner.run failing the commands that mention iface.
+func failOn(iface string) func(context.Context, []string) (string, string, error) {
+	return func(_ context.Context, argv []string) (string, string, error) {
+		for _, arg := range argv {
+			if arg == iface {
+				return "", "arping: sendto: Network is unreachable\n", &ErrArpingFailed{ExitCode: 2, Stderr: "arping: sendto: Network is unreachable\n"}
+			}
+		}
+		return "", "", nil
+	}
+}
+
+func TestAnnounceAll(t *testing.T) {
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{Count: 2, Parallel: 1})
+	ifaces := []Interface{
+		ethernet(2, "eth0", "192.0.2.10/24", "fe80::1/64"),
+		ethernet(3, "eth1", "198.51.100.7/24"),
+	}
+	routes := []Route{defaultRoute("eth0", "192.0.2.1", 0), defaultRoute("eth1", "198.51.100.1", 0)}
+
+	results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"arping -U -c 2 -I eth0 -s 192.0.2.10 192.0.2.1",
+		"arping -U -c 2 -I eth1 -s 198.51.100.7 198.51.100.1",
+	}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+	if results.Attempted() != 2 || results.Succeeded() != 2 || len(results.Skipped()) != 1 {
+		t.Errorf("got %d attempted, %d succeeded and %d skipped, want 2, 2 and 1",
+			results.Attempted(), results.Succeeded(), len(results.Skipped()))
+	}
+	if results[0].PacketsSent != 2 || results[0].Attempts != 1 {
+		t.Errorf("got %d packets in %d attempts, want 2 in 1", results[0].PacketsSent, results[0].Attempts)
+	}
+}
+
+func TestAnnounceAllContinuesAfterFailure(t *testing.T) {
+	r := &fakeRunner{run: failOn("eth1")}
+	opts := testOptions(t, r, Options{Parallel: 1})
+
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.commands()); n != 3 {
+		t.Errorf("ran %d commands, want all 3", n)
+	}
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].Interface != "eth1" || results.Succeeded() != 2 {
+		t.Fatalf("got failures %v and %d successes, want only eth1 to fail", failed, results.Succeeded())
+	}
+	var arpingErr *ErrArpingFailed
+	if !errors.As(failed[0].Err, &arpingErr) || arpingErr.ExitCode != 2 || !strings.Contains(failed[0].Stderr, "unreachable") {
+		t.Errorf("got error %v with stderr %q, want exit status 2 and arping's stderr", failed[0].Err, failed[0].Stderr)
+	}
+}
+
+func TestAnnounceAllCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &fakeRunner{run: func(context.Context, []string) (string, string, error) {
+		cancel() // while the first announcement runs
+		return "", "", nil
+	}}
+	opts := testOptions(t, r, Options{Parallel: 1})
+
+	results, err := announceAll(ctx, opts, planning(opts, threeInterfaces, threeRoutes))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if n := len(r.commands()); n != 1 {
+		t.Errorf("ran %d commands after cancelling, want only the first", n)
+	}
+	if results.Attempted() != 1 {
+		t.Errorf("got %d results, want only the one started", results.Attempted())
+	}
+}
+
+func TestAnnounceAllGrace(t *testing.T) {
+	for _, tt := range []struct {
+		grace  time.Duration
+		killed bool
+	}{
+		{0, true},                // stopped at once
+		{time.Minute, false},     // left to finish
+		{time.Millisecond, true}, // stopped when the grace period is over
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &fakeRunner{run: func(ctx context.Context, _ []string) (string, string, error) {
+			cancel() // Ctrl-C while arping runs
+			select {
+			case <-ctx.Done():
+				return "", "", ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+				return "Sent 1 probes\n", "", nil
+			}
+		}}
+		opts := testOptions(t, r, Options{Parallel: 1, Grace: tt.grace})
+
+		results, err := announceAll(ctx, opts, planning(opts, threeInterfaces, threeRoutes))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("grace %s: got error %v, want context.Canceled", tt.grace, err)
+		}
+		if n := len(r.commands()); n != 1 {
+			t.Errorf("grace %s: ran %d commands after cancelling, want only the first", tt.grace, n)
+		}
+		if failed := len(results.Failed()); (failed == 1) != tt.killed {
+			t.Errorf("grace %s: got %d failed, want the running command killed %t", tt.grace, failed, tt.killed)
+		}
+		cancel()
+	}
+}
+
+func TestAnnounceCancelKillsCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, _, err := (execRunner{}).Run(ctx, "sleep", "10"); err == nil {
+		t.Error("a cancelled command succeeded")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s to stop after cancelling", d)
+	}
+}
+
+func TestAnnounceAllParallel(t *testing.T) {
+	ifaces, routes := manyInterfaces(8)
+	for _, tt := range []struct {
+		parallel, want int
+	}{
+		{1, 1},
+		{3, 3},
+		{0, 8}, // one per announcement
+	} {
+		r := &fakeRunner{run: func(context.Context, []string) (string, string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "", "", nil
+		}}
+		opts := testOptions(t, r, Options{Parallel: tt.parallel})
+		results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results.Succeeded() != 8 {
+			t.Errorf("parallel %d: %d of 8 succeeded", tt.parallel, results.Succeeded())
+		}
+		if r.maxRunning != tt.want {
+			t.Errorf("parallel %d: at most %d ran at once, want %d", tt.parallel, r.maxRunning, tt.want)
+		}
+	}
+}
+
+func TestAnnounceLogsCommands(t *testing.T) {
+	for _, tt := range []struct {
+		level  slog.Level
+		dryRun bool
+		want   string // logged for each command, if anything
+	}{
+		{slog.LevelInfo, true, "Would execute"},
+		{slog.LevelError, true, ""}, // -q
+		{slog.LevelInfo, false, ""},
+		{slog.LevelDebug, false, "Executing"}, // -v
+	} {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: tt.level}))
+		opts := testOptions(t, &fakeRunner{}, Options{DryRun: tt.dryRun, Logger: logger})
+		if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes)); err != nil {
+			t.Fatal(err)
+		}
+		logged := strings.Count(buf.String(), "command=")
+		switch {
+		case tt.want == "" && logged > 0:
+			t.Errorf("level %s, dry run %v: logged commands:\n%s", tt.level, tt.dryRun, buf.String())
+		case tt.want != "" && (logged != 3 || strings.Count(buf.String(), tt.want) != 3):
+			t.Errorf("level %s, dry run %v: want %q for each of 3 commands, got:\n%s", tt.level, tt.dryRun, tt.want, buf.String())
+		}
+	}
+}
+
+func TestAnnounceAllTimeout(t *testing.T) {
+	r := &fakeRunner{run: func(ctx context.Context, argv []string) (string, string, error) {
+		if contains(argv, "eth0") {
+			<-ctx.Done() // hangs until killed
+			return "", "", ctx.Err()
+		}
+		return "", "", nil
+	}}
+	opts := testOptions(t, r, Options{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s with a 50ms timeout", elapsed)
+	}
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].Interface != "eth0" || results.Succeeded() != 2 {
+		t.Fatalf("got failures %v and %d successes, want only eth0 to time out", failed, results.Succeeded())
+	}
+	if err := failed[0].Err; !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+}
+
+func TestAnnounceAllInterval(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	ifaces, routes := manyInterfaces(4)
+	for _, parallel := range []int{1, 4} {
+		var starts []time.Time
+		r := &fakeRunner{run: lockedRun(func(context.Context, []string) (string, string, error) {
+			starts = append(starts, time.Now())
+			return "", "", nil
+		})}
+		opts := testOptions(t, r, Options{Parallel: parallel, Interval: interval})
+
+		begin := time.Now()
+		if _, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes)); err != nil {
+			t.Fatal(err)
+		}
+		if len(starts) != 4 {
+			t.Fatalf("parallel %d: ran %d commands, want 4", parallel, len(starts))
+		}
+		if first := starts[0].Sub(begin); first >= interval {
+			t.Errorf("parallel %d: waited %s before the first announcement", parallel, first)
+		}
+		for i := 1; i < len(starts); i++ {
+			if gap := starts[i].Sub(starts[i-1]); gap < interval {
+				t.Errorf("parallel %d: announcement %d started %s after the one before, want at least %s", parallel, i, gap, interval)
+			}
+		}
+	}
+}
+
+// lockedRun returns run, serialized so that it can append to a slice.
+func lockedRun(run func(context.Context, []string) (string, string, error)) func(context.Context, []string) (string, string, error) {
+	var mu sync.Mutex
+	return func(ctx context.Context, argv []string) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return run(ctx, argv)
+	}
+}
+
+// failFirst returns a fakeRunner.run failing the first n commands with
+// stderr.
+func failFirst(n int, stderr string) func(context.Context, []string) (string, string, error) {
+	calls := 0
+	return lockedRun(func(context.Context, []string) (string, string, error) {
+		if calls++; calls <= n {
+			return "", stderr, &ErrArpingFailed{ExitCode: 2, Stderr: stderr}
+		}
+		return "", "", nil
+	})
+}
+
+func TestAnnounceRetries(t *testing.T) {
+	ifaces, routes := manyInterfaces(1)
+	for _, tt := range []struct {
+		failures, retries int
+		stderr            string
+		attempts          int
+		ok                bool
+	}{
+		{2, 3, "arping: sendto: No buffer space available", 3, true},
+		{2, 1, "arping: sendto: No buffer space available", 2, false},
+		{2, 3, "arping: unknown iface eth0", 1, false}, // no retry will fix it
+	} {
+		r := &fakeRunner{run: failFirst(tt.failures, tt.stderr)}
+		opts := testOptions(t, r, Options{Retries: tt.retries, RetryBackoff: time.Millisecond})
+		results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := results[0]
+		if res.Attempts != tt.attempts || (res.Err == nil) != tt.ok || len(r.commands()) != tt.attempts {
+			t.Errorf("%d failures (%s), %d retries: got %d attempts, %d commands and error %v; want %d attempts, ok %v",
+				tt.failures, tt.stderr, tt.retries, res.Attempts, len(r.commands()), res.Err, tt.attempts, tt.ok)
+		}
+	}
+}
+
+func TestAnnounceSource(t *testing.T) {
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{Parallel: 1, AnnounceSource: net.ParseIP("192.0.2.100")})
+	if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"arping -U -c 1 -I eth0 -s 192.0.2.100 192.0.2.1",
+		"arping -U -c 1 -I eth1 -s 198.51.100.7 198.51.100.1",
+		"arping -U -c 1 -I eth2 -s 203.0.113.5 203.0.113.1",
+	}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+
+	opts.AnnounceSource = net.ParseIP("10.9.9.9")
+	if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes)); err == nil {
+		t.Error("no error for an announce source on no local subnet")
+	}
+}
+
+func TestResults(t *testing.T) {
+	failure := errors.New("exit status 1")
+	results := Results{
+		{Interface: "eth0", PacketsSent: 3},
+		{Interface: "eth1", PacketsSent: 6, Err: failure},
+		{Interface: "eth2", PacketsSent: 3},
+		{Interface: "eth3", Skipped: "no default gateway"},
+	}
+	if got := results.Failed(); len(got) != 1 || got[0].Interface != "eth1" {
+		t.Errorf("Failed() = %v, want eth1", got)
+	}
+	if got := results.Skipped(); len(got) != 1 || got[0].Interface != "eth3" {
+		t.Errorf("Skipped() = %v, want eth3", got)
+	}
+	if got := results.Attempted(); got != 3 {
+		t.Errorf("Attempted() = %d, want 3", got)
+	}
+	if got := results.Succeeded(); got != 2 {
+		t.Errorf("Succeeded() = %d, want 2", got)
+	}
+	if got := results.PacketsSent(); got != 12 {
+		t.Errorf("PacketsSent() = %d, want 12", got)
+	}
+	var empty Results
+	if empty.Failed() != nil || empty.Skipped() != nil || empty.Attempted() != 0 || empty.Succeeded() != 0 || empty.PacketsSent() != 0 {
+		t.Error("empty results aren't all zero")
+	}
+}
+
+func TestAnnounceAllMax(t *testing.T) {
+	ifaces, routes := manyInterfaces(8)
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{Max: 3})
+
+	results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.commands()); n != 3 {
+		t.Errorf("ran %d commands, want the cap of 3", n)
+	}
+	capped := 0
+	for _, res := range results.Skipped() {
+		if res.Skipped == skipCapped {
+			capped++
+		}
+	}
+	if len(results) != 8 || capped != 5 {
+		t.Errorf("got %d results with %d over the cap, want 8 with 5", len(results), capped)
+	}
+}
+
+func TestAnnounceOnResult(t *testing.T) {
+	// eth2 has no gateway and is skipped; eth1 fails.
+	var mu sync.Mutex
+	got := make(map[string]int)
+	r := &fakeRunner{run: failOn("eth1")}
+	opts := testOptions(t, r, Options{OnResult: func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case res.Skipped != "":
+			got["skipped"]++
+		case res.Err != nil:
+			got["failed"]++
+		default:
+			got["ok"]++
+		}
+	}})
+
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes[:2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"ok": 1, "failed": 1, "skipped": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got callbacks %v, want %v", got, want)
+	}
+	if calls := got["ok"] + got["failed"] + got["skipped"]; calls != len(results) {
+		t.Errorf("got %d callbacks for %d results", calls, len(results))
+	}
+}
+
+func TestAnnounceNoGateway(t *testing.T) {
+	// No default routes at all, so only -no-gateway announces.
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{NoGateway: true, Parallel: 1})
+	if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:2], nil)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.10",
+		"arping -U -c 1 -I eth1 -s 198.51.100.7 198.51.100.7",
+	}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestAnnounceSudo(t *testing.T) {
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{Sudo: true, Verify: true})
+	if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:1], threeRoutes[:1])); err != nil {
+		t.Fatal(err)
+	}
+	// Both the announcement and its verification run under sudo, without
+	// prompting for a password.
+	want := []string{
+		"sudo -n arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1",
+		"sudo -n arping -c 1 -I eth0 -s 192.0.2.10 192.0.2.1",
+	}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestAnnounceVerify(t *testing.T) {
+	// eth0's gateway replies to the plain request; eth1's doesn't, which
+	// arping reports by exiting 1.
+	r := &fakeRunner{run: func(_ context.Context, argv []string) (string, string, error) {
+		switch {
+		case contains(argv, "-U"):
+			return "Sent 1 probes (1 broadcast(s))\n", "", nil
+		case contains(argv, "eth0"):
+			return "Unicast reply from 192.0.2.1 [02:00:00:00:01:01]  0.612ms\nReceived 1 response(s)\n", "", nil
+		}
+		return "Sent 1 probes (1 broadcast(s))\nReceived 0 response(s)\n", "", &ErrArpingFailed{ExitCode: 1}
+	}}
+	opts := testOptions(t, r, Options{Verify: true})
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:2], threeRoutes[:2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := make(map[string]bool)
+	for _, res := range results {
+		if res.Err != nil {
+			t.Errorf("%s: announcement failed: %v", res.Interface, res.Err)
+		}
+		verified[res.Interface] = res.Verified
+	}
+	if want := map[string]bool{"eth0": true, "eth1": false}; !reflect.DeepEqual(verified, want) {
+		t.Errorf("got verified %v, want %v", verified, want)
+	}
+	if n := len(r.commands()); n != 4 {
+		t.Errorf("ran %d commands, want an announcement and a request per interface", n)
+	}
+}
+
+func TestAnnouncePacketsSent(t *testing.T) {
+	ifaces, routes := manyInterfaces(2)
+	fails := failFirst(2, "arping: sendto: No buffer space available")
+	r := &fakeRunner{run: func(ctx context.Context, argv []string) (string, string, error) {
+		if contains(argv, "eth0") {
+			return fails(ctx, argv)
+		}
+		return "", "", nil
+	}}
+	opts := testOptions(t, r, Options{Count: 3, Retries: 3, RetryBackoff: time.Millisecond})
+	results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -count is packets per arping, -retries how many more arpings a
+	// failure may take.
+	sent := make(map[string][2]int)
+	for _, res := range results {
+		sent[res.Interface] = [2]int{res.Attempts, res.PacketsSent}
+	}
+	if want := map[string][2]int{"eth0": {3, 9}, "eth1": {1, 3}}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("got attempts and packets %v, want %v", sent, want)
+	}
+	if total := results.PacketsSent(); total != 12 {
+		t.Errorf("got %d packets in total, want 12", total)
+	}
+}
+
+func TestAnnounceStrict(t *testing.T) {
+	// eth1 has no gateway; eth0's IPv6 address can't be announced without
+	// ndsend, which is benign even with Strict.
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24", "2001:db8::10/64"), threeInterfaces[1]}
+	for _, strict := range []bool{false, true} {
+		opts := testOptions(t, &fakeRunner{}, Options{Strict: strict})
+		results, err := announceAll(context.Background(), opts, planning(opts, ifaces, threeRoutes[:1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed, skipped := results.Failed(), results.Skipped()
+		switch {
+		case !strict && (len(failed) != 0 || len(skipped) != 2):
+			t.Errorf("without Strict: got %d failed and %d skipped, want 0 and 2", len(failed), len(skipped))
+		case strict && (len(failed) != 1 || len(skipped) != 1):
+			t.Errorf("with Strict: got %d failed and %d skipped, want 1 and 1", len(failed), len(skipped))
+		case strict && (failed[0].Interface != "eth1" || !errors.Is(failed[0].Err, ErrSkipped) || skipped[0].Addr != "2001:db8::10/64"):
+			t.Errorf("with Strict: got failure %+v and skip %+v", failed[0], skipped[0])
+		}
+		for _, r := range results {
+			if r.Err != nil && r.Skipped != "" {
+				t.Errorf("Strict %t: %s got both error %v and skip %q", strict, r.Addr, r.Err, r.Skipped)
+			}
+		}
+	}
+}
+
+func TestAnnounceArgsFunc(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		opts  Options
+		argsF func(iface, source, gateway string, base []string) []string
+		want  string
+	}{
+		{
+			"append -w 2",
+			Options{},
+			func(_, _, _ string, base []string) []string { return append(base, "-w", "2") },
+			"arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1 -w 2",
+		},
+		{
+			"after -extra-args",
+			Options{ExtraArgs: []string{"-b"}},
+			func(_, _, _ string, base []string) []string { return append(base, "-w", "2") },
+			"arping -U -c 1 -I eth0 -s 192.0.2.10 -b 192.0.2.1 -w 2",
+		},
+		{
+			"dropping -s is ignored",
+			Options{},
+			func(_, _, gateway string, _ []string) []string { return []string{"-U", "-I", "eth0", gateway} },
+			"arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1",
+		},
+	} {
+		r := &fakeRunner{}
+		tt.opts.ArgsFunc = tt.argsF
+		opts := testOptions(t, r, tt.opts)
+		if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:1], threeRoutes[:1])); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.commands(); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: ran %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnnounceDualStackGateways(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "2001:db8::10/64", "192.0.2.10/24")}
+	// A second IPv4 default route via an IPv6 next hop (RTA_VIA) can't be
+	// announced to from the IPv4 address.
+	viaV6 := defaultRoute("eth0", "192.0.2.1", 10)
+	viaV6.Gateway = net.ParseIP("fe80::2")
+	routes := []Route{defaultRoute("eth0", "fe80::1", 0), defaultRoute("eth0", "192.0.2.1", 0), viaV6}
+
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{Family: FamilyBoth, Ndsend: "ndsend", Parallel: 1})
+	results, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Err != nil || res.Skipped != "" || (res.SourceIP.To4() == nil) != (res.Gateway.To4() == nil) {
+			t.Errorf("got %s to %s (skipped %q, error %v)", res.SourceIP, res.Gateway, res.Skipped, res.Err)
+		}
+	}
+	want := []string{"ndsend 2001:db8::10 eth0", "arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1"}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestAnnounceOutput(t *testing.T) {
+	r := &fakeRunner{run: func(_ context.Context, argv []string) (string, string, error) {
+		return "ARPING " + argv[len(argv)-1] + " from " + argv[len(argv)-2] + "\nSent 1 probes (1 broadcast(s))\n", "", nil
+	}}
+	var output, logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	opts := testOptions(t, r, Options{Output: &output, Logger: logger, Parallel: 1})
+	if _, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:2], threeRoutes[:2])); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"ARPING 192.0.2.1 from 192.0.2.10\n", "ARPING 198.51.100.1 from 198.51.100.7\n"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, output.String())
+		}
+	}
+	if strings.Contains(logs.String(), "ARPING") {
+		t.Errorf("arping's output went to the logs:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1") {
+		t.Errorf("the command wasn't logged:\n%s", logs.String())
+	}
+}
+
+func TestAnnounceRandomizeOrder(t *testing.T) {
+	ifaces, routes := manyInterfaces(8)
+	order := func(opts Options) []string {
+		t.Helper()
+		r := &fakeRunner{}
+		opts.Parallel = 1
+		opts = testOptions(t, r, opts)
+		if _, err := announceAll(context.Background(), opts, planning(opts, ifaces, routes)); err != nil {
+			t.Fatal(err)
+		}
+		return r.commands()
+	}
+
+	discovered := order(Options{})
+	for n, cmd := range discovered {
+		if !strings.Contains(cmd, fmt.Sprintf(" eth%d ", n)) {
+			t.Fatalf("without RandomizeOrder, command %d is %q, want discovery order", n, cmd)
+		}
+	}
+	shuffled := order(Options{RandomizeOrder: true, Seed: 42})
+	if reflect.DeepEqual(shuffled, discovered) {
+		t.Errorf("RandomizeOrder with seed 42 kept discovery order %q", shuffled)
+	}
+	if again := order(Options{RandomizeOrder: true, Seed: 42}); !reflect.DeepEqual(again, shuffled) {
+		t.Errorf("the same seed gave %q, then %q", shuffled, again)
+	}
+	sorted := append([]string(nil), shuffled...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, discovered) {
+		t.Errorf("RandomizeOrder ran %q, want the same commands as %q", shuffled, discovered)
+	}
+}
+
+func TestAnnounceDAD(t *testing.T) {
+	// Another host replies for eth0's address, which iputils arping -D
+	// reports by exiting 1; nobody has eth1's.
+	r := &fakeRunner{run: func(_ context.Context, argv []string) (string, string, error) {
+		switch {
+		case !contains(argv, "-D"):
+			return "Sent 1 probes (1 broadcast(s))\n", "", nil
+		case contains(argv, "eth0"):
+			return "Unicast reply from 192.0.2.10 [02:00:00:00:09:09]  0.701ms\nSent 1 probes (1 broadcast(s))\nReceived 1 response(s)\n", "", &ErrArpingFailed{ExitCode: 1}
+		}
+		return "Sent 1 probes (1 broadcast(s))\nReceived 0 response(s)\n", "", nil
+	}}
+	opts := testOptions(t, r, Options{DAD: true, Parallel: 1})
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:2], threeRoutes[:2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range results {
+		switch res.Interface {
+		case "eth0":
+			if !res.Conflict || !errors.Is(res.Err, ErrAddressConflict) {
+				t.Errorf("eth0: got conflict %t, err %v, want ErrAddressConflict", res.Conflict, res.Err)
+			}
+		case "eth1":
+			if res.Conflict || res.Err != nil {
+				t.Errorf("eth1: got conflict %t, err %v, want it announced", res.Conflict, res.Err)
+			}
+		}
+	}
+	want := []string{
+		"arping -D -c 1 -I eth0 192.0.2.10",
+		"arping -D -c 1 -I eth1 198.51.100.7",
+		"arping -U -c 1 -I eth1 -s 198.51.100.7 198.51.100.1",
+	}
+	if got := r.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got commands %q, want %q", got, want)
+	}
+}
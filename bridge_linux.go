@@ -0,0 +1,29 @@
+package arpingall
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// sysClassNet is where sysfs lists the network interfaces, which tests
+// replace.
+var sysClassNet = "/sys/class/net"
+
+// bridgeMembers returns the ports of the bridge named name from
+// /sys/class/net/<name>/brif, or nil if it isn't a bridge.
+func bridgeMembers(name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(sysClassNet, name, "brif"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(entries))
+	for _, e := range entries {
+		members = append(members, e.Name())
+	}
+	return members, nil
+}
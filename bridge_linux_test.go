@@ -0,0 +1,24 @@
+package arpingall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBridgeMembers(t *testing.T) {
+	defer func(dir string) { sysClassNet = dir }(sysClassNet)
+	sysClassNet = "testdata/sysfs"
+
+	members, err := bridgeMembers("br0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"eth0", "eth1"}; !reflect.DeepEqual(members, want) {
+		t.Errorf("br0: got members %q, want %q", members, want)
+	}
+	for _, name := range []string{"eth0", "missing0"} {
+		if members, err := bridgeMembers(name); members != nil || err != nil {
+			t.Errorf("%s isn't a bridge, got %q, %v", name, members, err)
+		}
+	}
+}
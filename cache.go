@@ -0,0 +1,118 @@
+package arpingall
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Cache remembers the interfaces and routes found by one run so that later
+// runs only rediscover what was marked as changed with Refresh. Set it as
+// Options.Cache and keep the rest of Options the same between runs. The zero
+// value is an empty cache ready to use, and it is safe for concurrent use.
+type Cache struct {
+	mu          sync.Mutex
+	loaded      bool
+	names       []string // in discovery order
+	ifaces      map[string]Interface
+	stale       map[string]bool
+	routes      []Route
+	routes6     []Route
+	routesStale bool
+}
+
+// Refresh marks the interface named ifName as changed, so that the next run
+// lists its addresses again. Routes are re-read too, since the kernel only
+// dumps them all at once.
+func (c *Cache) Refresh(ifName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stale == nil {
+		c.stale = make(map[string]bool)
+	}
+	c.stale[ifName] = true
+	c.routesStale = true
+}
+
+// RefreshAll empties the cache, so that the next run rediscovers everything.
+func (c *Cache) RefreshAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false
+}
+
+// discover returns the interfaces passing f and the routes from source,
+// reading only what is missing or stale.
+func (c *Cache) discover(f Filter, source string, logger *slog.Logger) ([]Interface, []Route, []Route, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		routes, routes6, err := loadRoutes(source, logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		ifaces, err := interfaces(f, logger)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("getting interfaces: %w", err)
+		}
+		c.names = nil
+		c.ifaces = make(map[string]Interface)
+		for _, i := range ifaces {
+			c.names = append(c.names, i.Name)
+			c.ifaces[i.Name] = i
+		}
+		c.routes, c.routes6 = routes, routes6
+		c.stale, c.routesStale = nil, false
+		c.loaded = true
+		return ifaces, routes, routes6, nil
+	}
+
+	if c.routesStale {
+		routes, routes6, err := loadRoutes(source, logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		c.routes, c.routes6 = routes, routes6
+		c.routesStale = false
+	}
+	for name := range c.stale {
+		c.refreshInterface(name, f, logger)
+	}
+	c.stale = nil
+
+	ifaces := make([]Interface, 0, len(c.names))
+	for _, name := range c.names {
+		ifaces = append(ifaces, c.ifaces[name])
+	}
+	return ifaces, c.routes, c.routes6, nil
+}
+
+// refreshInterface lists the interface named name again, dropping it from
+// the cache if it is gone or no longer passes f.
+func (c *Cache) refreshInterface(name string, f Filter, logger *slog.Logger) {
+	_, known := c.ifaces[name]
+	ifi, err := net.InterfaceByName(name)
+	if err == nil {
+		if iface, ok := interfaceFrom(*ifi, f, logger); ok {
+			if !known {
+				c.names = append(c.names, name)
+			}
+			c.ifaces[name] = iface
+			return
+		}
+	} else {
+		logger.Debug("Dropping interface from cache", "iface", name, "err", err)
+	}
+	if !known {
+		return
+	}
+	delete(c.ifaces, name)
+	for i, n := range c.names {
+		if n == name {
+			c.names = append(c.names[:i], c.names[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package arpingall
+
+import "testing"
+
+// BenchmarkDiscover compares the discovery done by each re-announce in
+// watch mode with and without a Cache, over the host's own interfaces and
+// routes.
+func BenchmarkDiscover(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		opts := Options{Logger: discardLogger}
+		for i := 0; i < b.N; i++ {
+			if _, _, _, err := discover(opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		opts := Options{Logger: discardLogger, Cache: &Cache{}}
+		for i := 0; i < b.N; i++ {
+			if _, _, _, err := discover(opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package arpingall
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// capNetRaw is the capability needed to open raw and packet sockets.
+const capNetRaw = 13
+
+// HasNetRaw reports whether this process has CAP_NET_RAW in its effective
+// set, as -native and an arping without capabilities of its own need.
+func HasNetRaw() (bool, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return hasNetRaw(file)
+}
+
+// hasNetRaw reports whether the CapEff line of a /proc/<pid>/status file
+// includes CAP_NET_RAW:
+//
+//	CapEff:	0000000000002000
+func hasNetRaw(r io.Reader) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("parse CapEff: %w", err)
+		}
+		return caps&(1<<capNetRaw) != 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("no CapEff in /proc/self/status")
+}
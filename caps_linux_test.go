@@ -0,0 +1,34 @@
+package arpingall
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHasNetRaw(t *testing.T) {
+	for file, want := range map[string]bool{
+		"testdata/status-root.txt":   true,
+		"testdata/status-netraw.txt": true, // e.g. setcap cap_net_raw+ep
+		"testdata/status-user.txt":   false,
+	} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := hasNetRaw(f)
+		f.Close()
+		if err != nil || got != want {
+			t.Errorf("%s: got %t, %v; want %t", file, got, err, want)
+		}
+	}
+
+	for status, want := range map[string]string{
+		"Name:\tarpingall\nCapEff:\tnot hex\n": "parse CapEff",
+		"Name:\tarpingall\n":                   "no CapEff",
+	} {
+		if _, err := hasNetRaw(strings.NewReader(status)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("hasNetRaw(%q) = %v, want an error containing %q", status, err, want)
+		}
+	}
+}
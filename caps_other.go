@@ -0,0 +1,11 @@
+//go:build !linux
+
+package arpingall
+
+import "errors"
+
+// HasNetRaw reports whether this process may open raw sockets. It is only
+// supported on Linux.
+func HasNetRaw() (bool, error) {
+	return false, errors.ErrUnsupported
+}
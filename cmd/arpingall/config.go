@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+// configKeys maps each key allowed in the -config file to the flag that
+// overrides it.
+var configKeys = map[string]string{
+	"arping":     "arping",
+	"ndsend":     "ndsend",
+	"count":      "count",
+	"interval":   "interval",
+	"timeout":    "timeout",
+	"interfaces": "interface",
+	"exclude":    "exclude",
+	"family":     "family",
+	"mode":       "mode",
+}
+
+// config is a -config file: the subset of arpingall.Options it can set. Keys
+// the file doesn't have are nil.
+type config struct {
+	Arping     *string
+	Ndsend     *string
+	Count      *int
+	Interval   *time.Duration
+	Timeout    *time.Duration
+	Interfaces []string
+	Exclude    []string
+	Family     *arpingall.Family
+	Mode       *arpingall.Mode
+}
+
+// loadConfig reads the config file at path.
+func loadConfig(path string) (config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return config{}, err
+	}
+	defer file.Close()
+
+	values, err := parseConfig(file)
+	if err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	c, err := decodeConfig(values)
+	if err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// decodeConfig converts the values parsed from a config file to their types.
+// Lists may also be given as a comma-separated scalar, as with the flags.
+func decodeConfig(values map[string][]string) (config, error) {
+	var c config
+	for key, vals := range values {
+		if key == "interfaces" || key == "exclude" {
+			list := listFlag{}
+			for _, v := range vals {
+				list.Set(v)
+			}
+			if key == "interfaces" {
+				c.Interfaces = list
+			} else {
+				c.Exclude = list
+			}
+			continue
+		}
+
+		if len(vals) != 1 {
+			return config{}, fmt.Errorf("%s: must be a single value, not a list", key)
+		}
+		v := vals[0]
+		switch key {
+		case "arping":
+			c.Arping = &v
+		case "ndsend":
+			c.Ndsend = &v
+		case "count":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return config{}, fmt.Errorf("%s: must be an integer: %q", key, v)
+			}
+			c.Count = &n
+		case "interval", "timeout":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return config{}, fmt.Errorf("%s: must be a duration like 1s: %q", key, v)
+			}
+			if key == "interval" {
+				c.Interval = &d
+			} else {
+				c.Timeout = &d
+			}
+		case "family":
+			f := arpingall.Family(v)
+			c.Family = &f
+		case "mode":
+			m := arpingall.Mode(v)
+			c.Mode = &m
+		}
+	}
+	return c, nil
+}
+
+// apply sets the fields of opts that c has, except those whose flag given
+// reports was given on the command line, which win.
+func (c config) apply(opts *arpingall.Options, given func(flag string) bool) {
+	use := func(key string) bool { return !given(configKeys[key]) }
+	if c.Arping != nil && use("arping") {
+		opts.Arping = *c.Arping
+	}
+	if c.Ndsend != nil && use("ndsend") {
+		opts.Ndsend = *c.Ndsend
+	}
+	if c.Count != nil && use("count") {
+		opts.Count = *c.Count
+	}
+	if c.Interval != nil && use("interval") {
+		opts.Interval = *c.Interval
+	}
+	if c.Timeout != nil && use("timeout") {
+		opts.Timeout = *c.Timeout
+	}
+	if c.Interfaces != nil && use("interfaces") {
+		opts.Filter.Include = c.Interfaces
+	}
+	if c.Exclude != nil && use("exclude") {
+		opts.Filter.Exclude = c.Exclude
+	}
+	if c.Family != nil && use("family") {
+		opts.Family = *c.Family
+	}
+	if c.Mode != nil && use("mode") {
+		opts.Mode = *c.Mode
+	}
+}
+
+// parseConfig parses the subset of YAML used by config files: a flat mapping
+// of scalars and lists, with comments.
+//
+//	count: 3
+//	mode: reply
+//	interfaces: [eth0, eth1]
+//	exclude:
+//	  - docker0
+func parseConfig(r io.Reader) (map[string][]string, error) {
+	values := make(map[string][]string)
+	list := "" // key whose block list is being read
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "-"); ok {
+			if list == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNum)
+			}
+			values[list] = append(values[list], unquote(strings.TrimSpace(item)))
+			continue
+		}
+		list = ""
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNum)
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNum)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, known := configKeys[key]; !known {
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNum, key)
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNum, key)
+		}
+
+		switch {
+		case value == "":
+			list = key
+			values[key] = nil
+		case strings.HasPrefix(value, "["):
+			inner, ok := strings.CutSuffix(value[1:], "]")
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated list", lineNum)
+			}
+			values[key] = []string{}
+			for _, item := range strings.Split(inner, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values[key] = append(values[key], unquote(item))
+				}
+			}
+		default:
+			values[key] = []string{unquote(value)}
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes a # comment from line, unless it is inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote strips matching single or double quotes around s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+const sampleConfig = `# arpingall.yaml
+arping: /opt/bin/arping
+count: 5
+interval: 500ms
+mode: reply   # not update
+family: "both"
+interfaces: [eth0, 'eth1']
+exclude:
+  - docker0
+  - veth*
+`
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arpingall.yaml")
+	if err := os.WriteFile(path, []byte(sampleConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := arpingall.Options{
+		Arping: "arping",
+		Ndsend: "ndsend",
+		Family: arpingall.FamilyIPv4,
+		Count:  3,
+		Mode:   arpingall.ModeUpdate,
+	}
+
+	opts := defaults
+	cfg.apply(&opts, func(string) bool { return false })
+	want := arpingall.Options{
+		Arping:   "/opt/bin/arping",
+		Ndsend:   "ndsend",
+		Family:   arpingall.FamilyBoth,
+		Count:    5,
+		Mode:     arpingall.ModeReply,
+		Interval: 500 * time.Millisecond,
+		Filter:   arpingall.Filter{Include: []string{"eth0", "eth1"}, Exclude: []string{"docker0", "veth*"}},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("got  %+v\nwant %+v", opts, want)
+	}
+
+	// Flags given on the command line win over the file.
+	opts = defaults
+	cfg.apply(&opts, func(name string) bool { return name == "count" || name == "interface" })
+	if opts.Count != 3 || opts.Filter.Include != nil {
+		t.Errorf("flags didn't win: count %d, interfaces %v", opts.Count, opts.Filter.Include)
+	}
+	if opts.Mode != arpingall.ModeReply || len(opts.Filter.Exclude) != 2 {
+		t.Errorf("keys without a flag weren't applied: mode %s, exclude %v", opts.Mode, opts.Filter.Exclude)
+	}
+	if cfg.Timeout != nil {
+		t.Errorf("timeout %v isn't in the file", *cfg.Timeout)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		want   string
+	}{
+		{"colour: blue\n", `unknown key "colour"`},
+		{"count: 3\ncount: 4\n", `duplicate key "count"`},
+		{"count: three\n", "count: must be an integer"},
+		{"timeout: 5\n", "timeout: must be a duration"},
+		{"mode: [reply, update]\n", "mode: must be a single value"},
+		{"  count: 3\n", "unexpected indentation"},
+		{"- eth0\n", "list item without a key"},
+		{"interfaces: [eth0\n", "unterminated list"},
+	} {
+		path := filepath.Join(t.TempDir(), "arpingall.yaml")
+		if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadConfig(%q) = %v, want an error containing %q", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeConfigCommaList(t *testing.T) {
+	cfg, err := decodeConfig(map[string][]string{"exclude": {"docker0, veth*"}, "interfaces": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Exclude, []string{"docker0", "veth*"}) {
+		t.Errorf("got exclude %q", cfg.Exclude)
+	}
+	if cfg.Interfaces == nil || len(cfg.Interfaces) != 0 {
+		t.Errorf("an empty list should be set and empty, got %#v", cfg.Interfaces)
+	}
+}
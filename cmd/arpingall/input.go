@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/brandt/arpingall"
+)
+
+// readPairs reads announcements from r, one "iface source_ip gateway_ip" per
+// line. Blank lines and # comments are ignored. Malformed lines are logged and
+// skipped; it returns how many there were.
+func readPairs(r io.Reader) ([]arpingall.Pair, int, error) {
+	var pairs []arpingall.Pair
+	malformed := 0
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		pair, err := parsePair(line)
+		if err != nil {
+			slog.Error("Skipping malformed input line", "line", lineNum, "err", err)
+			malformed++
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, malformed, scanner.Err()
+}
+
+// parsePair parses an "iface source_ip gateway_ip" line.
+func parsePair(line string) (arpingall.Pair, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return arpingall.Pair{}, fmt.Errorf("expected 3 fields (iface source_ip gateway_ip), got %d", len(fields))
+	}
+	source := net.ParseIP(fields[1])
+	if source == nil {
+		return arpingall.Pair{}, fmt.Errorf("invalid source IP %q", fields[1])
+	}
+	gateway := net.ParseIP(fields[2])
+	if gateway == nil {
+		return arpingall.Pair{}, fmt.Errorf("invalid gateway IP %q", fields[2])
+	}
+	return arpingall.Pair{Interface: fields[0], Source: source, Gateway: gateway}, nil
+}
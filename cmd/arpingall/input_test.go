@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadPairs(t *testing.T) {
+	input := `# iface source gateway
+eth0 192.0.2.10 192.0.2.1
+eth1  198.51.100.7	198.51.100.1   # tabs and trailing comment
+
+eth2 192.0.2.300 192.0.2.1
+eth3 fd00::2 fd00::1
+eth4 192.0.2.11
+`
+	pairs, malformed, err := readPairs(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if malformed != 2 {
+		t.Errorf("got %d malformed lines, want 2", malformed)
+	}
+	want := []struct{ iface, source, gateway string }{
+		{"eth0", "192.0.2.10", "192.0.2.1"},
+		{"eth1", "198.51.100.7", "198.51.100.1"},
+		{"eth3", "fd00::2", "fd00::1"},
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("got %d pairs, want %d: %v", len(pairs), len(want), pairs)
+	}
+	for i, w := range want {
+		p := pairs[i]
+		if p.Interface != w.iface || !p.Source.Equal(net.ParseIP(w.source)) || !p.Gateway.Equal(net.ParseIP(w.gateway)) {
+			t.Errorf("pair %d: got %s %s %s, want %s %s %s", i, p.Interface, p.Source, p.Gateway, w.iface, w.source, w.gateway)
+		}
+	}
+}
+
+func TestParsePairErrors(t *testing.T) {
+	for _, line := range []string{
+		"eth0",
+		"eth0 192.0.2.10 192.0.2.1 extra",
+		"eth0 not-an-ip 192.0.2.1",
+		"eth0 192.0.2.10 gateway",
+	} {
+		if _, err := parsePair(line); err == nil {
+			t.Errorf("parsePair(%q) succeeded, want an error", line)
+		}
+	}
+}
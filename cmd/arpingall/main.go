@@ -0,0 +1,752 @@
+// Command arpingall sends a gratuitous ARP for every IP on every interface to
+// the interface's default gateway.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+var (
+	configPath       = flag.String("config", "", "read settings from this YAML file; flags given on the command line win")
+	arpingBinary     = flag.String("arping", getenv("ARPING_BINARY", "arping"), "arping command to run (env ARPING_BINARY)")
+	ndsendBinary     = flag.String("ndsend", "ndsend", "command used to send unsolicited IPv6 neighbor advertisements")
+	stdin            = flag.Bool("stdin", false, "announce the \"iface source_ip gateway_ip\" lines read from stdin instead of discovering them")
+	show             = flag.Bool("show", false, "print every interface with its MAC, state, type, addresses and default gateways, and whether it would be announced, then exit")
+	list             = flag.Bool("list", false, "print what would be announced and skipped, and why, then exit without sending")
+	dryRun           = flag.Bool("dry-run", false, "print the commands that would be run without running them")
+	family           = flag.String("family", "4", "address families to announce: 4, 6 (needs ndsend) or both")
+	mode             = flag.String("mode", "update", "send unsolicited ARP requests (update, arping -U) or replies (reply, arping -A)")
+	target           = flag.String("target", "", "announce to this IPv4 address instead of the default gateway")
+	broadcast        = flag.Bool("broadcast", false, "announce IPv4 addresses to the subnet broadcast address instead of the gateway")
+	refreshNeighbors = flag.Bool("refresh-neighbors", false, "also announce IPv4 addresses to every neighbor in the ARP cache, not just the gateway")
+	bridgeMembers    = flag.Bool("bridge-members", false, "also send IPv4 announcements on a bridge out of each member port")
+	oncePerSubnet    = flag.Bool("once-per-subnet", false, "announce each subnet and gateway on only one interface")
+	sourceSelection  = flag.String("source-selection", string(arpingall.SourceAll), "which IPv4 addresses of an interface to announce to each gateway: all, or only the first, the lowest, or the route's preferred source (prefsrc)")
+	prefSrc          = flag.Bool("prefsrc", false, "short for -source-selection prefsrc")
+	announceSource   = flag.String("announce-source", "", "announce this IPv4 address (e.g. a floating VIP) as the sender on the interface whose subnet contains it")
+	firstGatewayOnly = flag.Bool("first-gateway-only", false, "announce IPv4 addresses only to the lowest-metric default gateway, not to every default gateway on the interface")
+	noGateway        = flag.Bool("no-gateway", false, "announce each address to itself instead of to a gateway, so no default route is needed")
+	changedOnly      = flag.Bool("changed-only", false, "only announce addresses that are new or changed since the last run, as recorded in -state-file")
+	stateFile        = flag.String("state-file", "/var/lib/arpingall/state.json", "where -changed-only records the addresses announced")
+	quietSkips       = flag.Bool("quiet-skips", false, "only log skipped addresses with -v")
+	strict           = flag.Bool("strict", false, "fail instead of warning when an IPv4 address is assigned to more than one interface, count IPv4 addresses that can't be announced (e.g. no gateway) as failed instead of skipped, and refuse to run without CAP_NET_RAW")
+	stream           = flag.Bool("stream", false, "print each command's output as it runs, prefixed with the interface name")
+	format           = flag.String("format", formatText, "how to print the results: text (only logs), json (a JSON array on stdout), jsonl (a JSON object per line as each completes) or csv (on stdout); logs go to stderr")
+	jsonOutput       = flag.Bool("json", false, "short for -format json")
+	routes           = flag.String("routes", arpingall.RoutesAuto, "where to read routes from: auto, netlink or procfs")
+	table            = flag.Int("table", 0, "only use routes from this routing table id (e.g. 254 for main); 0 for all")
+	loop             = flag.Duration("loop", 0, "keep running and re-announce every `interval`")
+	watch            = flag.Bool("watch", false, "keep running and re-announce whenever an interface comes up or gains an address")
+	metricsAddr      = flag.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9100")
+	healthAddr       = flag.String("health-addr", "", "serve a /healthz liveness probe on this address; it may be the same as -metrics-addr")
+	healthMaxAge     = flag.Duration("health-max-age", 0, "report unhealthy if the last run completed longer ago than this (default twice -loop, or no limit without it)")
+	verbose          = flag.Bool("v", false, "verbose: also log every command and skipped address")
+	quiet            = flag.Bool("q", false, "quiet: only log errors")
+	targetMACFlag    = flag.String("target-mac", "", "with -native, send unicast to this MAC address, or auto for the gateway's from the ARP cache, instead of broadcast")
+	sourceMAC        = flag.String("source-mac", "", "with -native, send from this MAC address instead of the interface's")
+	dad              = flag.Bool("dad", false, "before each IPv4 announcement, check with arping -D that no other host has the address, and fail instead of announcing if one does")
+	neighState       = flag.Bool("neigh-state", false, "after each announcement, record the gateway's state in the neighbor table, e.g. REACHABLE or STALE (Linux only)")
+	verify           = flag.Bool("verify", false, "after each IPv4 announcement, check that the gateway answers an ARP request")
+	extraArgs        = flag.String("extra-args", "", "extra arguments for every arping command, before the target, e.g. \"-w 2\"")
+	sudo             = flag.Bool("sudo", false, "run arping and ndsend with \"sudo -n\", for when not running as root")
+	implementation   = flag.String("implementation", implExternal, "how to send IPv4 announcements: external (run arping), native (on a raw socket) or auto (native if permitted and -verify and -dad aren't used, else arping)")
+	native           = flag.Bool("native", false, "short for -implementation native")
+	count            = flag.Int("count", 1, "number of gratuitous ARPs each arping run sends per IP; retries send this many again")
+	timeout          = flag.Duration("timeout", 0, "kill an announcement still running after this long (default -count seconds plus 5s, as packets go a second apart: 6s for -count 1, 8s for -count 3; 0 = no limit)")
+	retries          = flag.Int("retries", 0, "rerun arping for a failed announcement up to this many times")
+	retryBackoff     = flag.Duration("retry-backoff", time.Second, "wait before the first retry; doubles after each retry")
+	grace            = flag.Duration("grace", 2*time.Second, "on SIGINT or SIGTERM, how long to let running announcements finish")
+	maxAnnouncements = flag.Int("max", 0, "announce at most this many addresses in one run; skip the rest (0 = no limit)")
+	wait             = flag.Duration("wait", 0, "if there is nothing to announce yet, as at boot, keep looking for up to this long")
+	randomizeOrder   = flag.Bool("randomize-order", false, "announce in random order, so that hosts run together don't announce in lockstep")
+	jitter           = flag.Duration("jitter", 0, "wait a random time up to this before the first announcement")
+	interval         = flag.Duration("interval", 0, "wait this long between announcements")
+	parallel         = flag.Int("parallel", 0, "number of announcements to run at once (0 = one per address, up to 16)")
+
+	metrics *arpingall.Metrics
+	health  *arpingall.Health
+
+	includeIfaces listFlag
+	excludeIfaces listFlag
+	allowGateways listFlag
+	gateways      = gatewayFlag{}
+	ifaceFilter   arpingall.Filter
+)
+
+func init() {
+	flag.Var(&includeIfaces, "interface", "only announce on these interfaces, by name or glob like 'eth*' (comma-separated, repeatable)")
+	flag.Var(&excludeIfaces, "exclude", "never announce on these interfaces, by name or glob like 'veth*' (comma-separated, repeatable); wins over -interface")
+	flag.BoolVar(&ifaceFilter.Regex, "regex", false, "treat -interface and -exclude as regular expressions matching the whole name")
+	flag.Var(gateways, "gw", "on iface, announce to gateway ip instead of the discovered one, as `iface=ip` (repeatable)")
+	flag.Var(&allowGateways, "allow-gateway", "only announce to these IPv4 gateways (comma-separated, repeatable)")
+	flag.BoolVar(&ifaceFilter.IncludeDown, "include-down", false, "also announce on interfaces that are administratively down")
+	flag.BoolVar(&ifaceFilter.IncludeLoopback, "include-loopback", false, "also announce on loopback interfaces")
+	flag.BoolVar(&ifaceFilter.IncludePointToPoint, "include-pointtopoint", false, "also announce on point-to-point interfaces")
+	flag.BoolVar(&ifaceFilter.AllTypes, "all-types", false, "also announce on interfaces that aren't Ethernet, such as tunnels")
+	flag.BoolVar(&ifaceFilter.IncludeZeroMAC, "include-zero-mac", false, "also announce on interfaces whose MAC address is all zeros")
+	flag.IntVar(&ifaceFilter.MinMTU, "min-mtu", 0, "skip interfaces whose MTU is below this, such as odd virtual links (0 = no minimum)")
+}
+
+// listFlag is a flag.Value collecting comma-separated values across repeated
+// uses of the flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// gatewayFlag is a flag.Value collecting iface=ip gateway overrides across
+// repeated uses of the flag.
+type gatewayFlag map[string]net.IP
+
+func (g gatewayFlag) String() string {
+	var pairs []string
+	for name, ip := range g {
+		pairs = append(pairs, name+"="+ip.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (g gatewayFlag) Set(value string) error {
+	name, addr, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("%q is not iface=ip", value)
+	}
+	ip := net.ParseIP(addr).To4()
+	if ip == nil || !ip.IsGlobalUnicast() {
+		return fmt.Errorf("%q is not a unicast IPv4 address", addr)
+	}
+	if _, dup := g[name]; dup {
+		return fmt.Errorf("gateway for %s given twice", name)
+	}
+	g[name] = ip
+	return nil
+}
+
+// flagSet reports whether the flag named name was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// timeoutSlack is how much longer than the -count seconds arping takes an
+// announcement may run by default.
+const timeoutSlack = 5 * time.Second
+
+// defaultTimeout returns the -timeout of announcements sending count
+// packets, which arping and -native send a second apart.
+func defaultTimeout(count int) time.Duration {
+	return time.Duration(count)*time.Second + timeoutSlack
+}
+
+// getenv returns the value of the environment variable key, or fallback if it
+// is unset or empty.
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	flag.Parse()
+	if *jsonOutput {
+		*format = formatJSON
+	}
+	slog.SetDefault(newLogger(os.Stderr, *verbose, *quiet, *format == formatJSON || *format == formatJSONL))
+	switch *format {
+	case formatText, formatJSON, formatJSONL, formatCSV:
+	default:
+		slog.Error("Invalid -format: must be text, json, jsonl or csv", "format", *format)
+		os.Exit(exitSetup)
+	}
+
+	// The settings a -config file can give, and flags on the command line
+	// override.
+	settings := arpingall.Options{
+		Arping:   *arpingBinary,
+		Ndsend:   *ndsendBinary,
+		Family:   arpingall.Family(*family),
+		Count:    *count,
+		Mode:     arpingall.Mode(*mode),
+		Timeout:  *timeout,
+		Interval: *interval,
+		Filter:   arpingall.Filter{Include: includeIfaces, Exclude: excludeIfaces},
+	}
+	var cfg config
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			slog.Error("Can't load config", "err", err)
+			os.Exit(exitSetup)
+		}
+		cfg.apply(&settings, flagSet)
+	}
+
+	fam := settings.Family
+	switch fam {
+	case arpingall.FamilyIPv4, arpingall.FamilyIPv6, arpingall.FamilyBoth:
+	default:
+		slog.Error("Invalid -family: must be 4, 6 or both", "family", fam)
+		os.Exit(exitSetup)
+	}
+
+	// arping only sends IPv4 announcements; ndsend sends the IPv6 ones.
+	ipv4 := fam != arpingall.FamilyIPv6
+
+	if *native {
+		*implementation = implNative
+	}
+	if ipv4 {
+		netRaw, _ := arpingall.HasNetRaw()
+		_, lookErr := exec.LookPath(settings.Arping)
+		useNative, err := chooseNative(*implementation, netRaw, lookErr == nil || *dryRun || *list || *show, *verify || *dad)
+		if err != nil {
+			slog.Error("Can't use -implementation", "implementation", *implementation, "err", err)
+			os.Exit(exitSetup)
+		}
+		*native = useNative
+		slog.Debug("Chose implementation", "implementation", *implementation, "native", *native)
+	}
+
+	if settings.Count < 1 {
+		slog.Error("Invalid -count: must be at least 1", "count", settings.Count)
+		os.Exit(exitSetup)
+	}
+	if !flagSet("timeout") && cfg.Timeout == nil {
+		settings.Timeout = defaultTimeout(settings.Count)
+	}
+	if *retries < 0 {
+		slog.Error("Invalid -retries: must not be negative", "retries", *retries)
+		os.Exit(exitSetup)
+	}
+	if *stdin && (*watch || *loop > 0 || *list || *show) {
+		slog.Error("-stdin can't be used with -watch, -loop, -list or -show")
+		os.Exit(exitSetup)
+	}
+	if *prefSrc {
+		*sourceSelection = string(arpingall.SourcePrefSrc)
+	}
+	switch arpingall.SourceSelection(*sourceSelection) {
+	case arpingall.SourceAll, arpingall.SourceFirst, arpingall.SourceLowest, arpingall.SourcePrefSrc:
+	default:
+		slog.Error("Invalid -source-selection: must be all, first, lowest or prefsrc", "source-selection", *sourceSelection)
+		os.Exit(exitSetup)
+	}
+	if *noGateway && (*target != "" || *broadcast || *sourceSelection != string(arpingall.SourceAll)) {
+		slog.Error("-no-gateway can't be used with -target, -broadcast, -source-selection or -prefsrc")
+		os.Exit(exitSetup)
+	}
+	if (*verify || *dad) && *native {
+		slog.Error("-verify and -dad need arping, so they can't be used with -native")
+		os.Exit(exitSetup)
+	}
+	if *stream && *format != formatText {
+		slog.Error("-stream can't be used with -format json, jsonl or csv")
+		os.Exit(exitSetup)
+	}
+	if *loop < 0 {
+		slog.Error("Invalid -loop: must not be negative", "loop", *loop)
+		os.Exit(exitSetup)
+	}
+	if *watch && *loop > 0 {
+		slog.Error("-watch and -loop can't be used together")
+		os.Exit(exitSetup)
+	}
+	if *maxAnnouncements < 0 {
+		slog.Error("Invalid -max: must not be negative", "max", *maxAnnouncements)
+		os.Exit(exitSetup)
+	}
+	if *parallel < 0 {
+		slog.Error("Invalid -parallel: must not be negative", "parallel", *parallel)
+		os.Exit(exitSetup)
+	}
+
+	var targetIP net.IP
+	if *target != "" {
+		targetIP = net.ParseIP(*target).To4()
+		if targetIP == nil {
+			slog.Error("Invalid -target: must be an IPv4 address", "target", *target)
+			os.Exit(exitSetup)
+		}
+		if *broadcast {
+			slog.Error("-target and -broadcast can't be used together")
+			os.Exit(exitSetup)
+		}
+	}
+
+	var sourceIP net.IP
+	if *announceSource != "" {
+		sourceIP = net.ParseIP(*announceSource).To4()
+		if sourceIP == nil || !sourceIP.IsGlobalUnicast() {
+			slog.Error("Invalid -announce-source: must be a unicast IPv4 address", "announce-source", *announceSource)
+			os.Exit(exitSetup)
+		}
+	}
+
+	var allowed []net.IP
+	for _, s := range allowGateways {
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			slog.Error("Invalid -allow-gateway: must be an IPv4 address", "allow-gateway", s)
+			os.Exit(exitSetup)
+		}
+		allowed = append(allowed, ip)
+	}
+
+	var srcMAC net.HardwareAddr
+	if *sourceMAC != "" {
+		if !*native {
+			slog.Error("-source-mac needs -native")
+			os.Exit(exitSetup)
+		}
+		var err error
+		srcMAC, err = net.ParseMAC(*sourceMAC)
+		if err != nil || len(srcMAC) != 6 {
+			slog.Error("Invalid -source-mac: must be an Ethernet MAC address like 02:00:00:00:00:01", "source-mac", *sourceMAC)
+			os.Exit(exitSetup)
+		}
+	}
+
+	var targetMAC net.HardwareAddr
+	if *targetMACFlag != "" {
+		if !*native {
+			slog.Error("-target-mac needs -native")
+			os.Exit(exitSetup)
+		}
+		if *targetMACFlag != "auto" {
+			var err error
+			targetMAC, err = net.ParseMAC(*targetMACFlag)
+			if err != nil || len(targetMAC) != 6 {
+				slog.Error("Invalid -target-mac: must be auto or an Ethernet MAC address like 02:00:00:00:00:01", "target-mac", *targetMACFlag)
+				os.Exit(exitSetup)
+			}
+		}
+	}
+
+	if !*dryRun && !*list && !*show {
+		if err := preflight(); err != nil {
+			slog.Error("Not privileged to send announcements", "err", err)
+			os.Exit(exitSetup)
+		}
+	}
+
+	arping, err := exec.LookPath(settings.Arping)
+	if err != nil {
+		if ipv4 && !*dryRun && !*native && !*list && !*show {
+			slog.Error("Can't find arping (set -arping or ARPING_BINARY)", "err", err)
+			os.Exit(exitNotFound)
+		}
+		arping = settings.Arping
+	}
+
+	var ndsend string
+	if fam != arpingall.FamilyIPv4 {
+		ndsend, err = exec.LookPath(settings.Ndsend)
+		switch {
+		case err == nil:
+		case fam == arpingall.FamilyBoth:
+			// With both families, IPv6 is best effort: without ndsend we
+			// still do IPv4.
+			slog.Info("IPv6 announcements disabled", "err", err)
+			ndsend = ""
+		case *dryRun || *list || *show:
+			ndsend = settings.Ndsend
+		default:
+			slog.Error("Can't find ndsend (set -ndsend)", "err", err)
+			os.Exit(exitNotFound)
+		}
+	}
+
+	ifaceFilter.Include = settings.Filter.Include
+	ifaceFilter.Exclude = settings.Filter.Exclude
+	opts := arpingall.Options{
+		Arping:           arping,
+		Ndsend:           ndsend,
+		Family:           fam,
+		Count:            settings.Count,
+		Mode:             settings.Mode,
+		Target:           targetIP,
+		Broadcast:        *broadcast,
+		AnnounceSource:   sourceIP,
+		Gateways:         gateways,
+		FirstGatewayOnly: *firstGatewayOnly,
+		NoGateway:        *noGateway,
+		Strict:           *strict,
+		QuietSkips:       *quietSkips,
+		AllowGateways:    allowed,
+		RefreshNeighbors: *refreshNeighbors,
+		SourceSelection:  arpingall.SourceSelection(*sourceSelection),
+		OncePerSubnet:    *oncePerSubnet,
+		BridgeMembers:    *bridgeMembers,
+		Verify:           *verify,
+		DAD:              *dad,
+		NeighState:       *neighState,
+		Sudo:             *sudo,
+		ExtraArgs:        strings.Fields(*extraArgs),
+		Native:           *native,
+		SourceMAC:        srcMAC,
+		TargetMAC:        targetMAC,
+		TargetMACAuto:    *targetMACFlag == "auto",
+		DryRun:           *dryRun,
+		Timeout:          settings.Timeout,
+		Parallel:         *parallel,
+		Interval:         settings.Interval,
+		Max:              *maxAnnouncements,
+		Grace:            *grace,
+		Wait:             *wait,
+		RandomizeOrder:   *randomizeOrder,
+		Jitter:           *jitter,
+		Retries:          *retries,
+		RetryBackoff:     *retryBackoff,
+		Filter:           ifaceFilter,
+		Routes:           *routes,
+		Table:            *table,
+		Stream:           *stream,
+		ChangedOnly:      *changedOnly,
+		StateFile:        *stateFile,
+		Output:           os.Stdout,
+		Logger:           slog.Default(),
+	}
+
+	if *format != formatText {
+		// Keep stdout pure JSON or CSV.
+		opts.Output = io.Discard
+	}
+	cycle := 0 // of -loop or -watch
+	if *format == formatJSONL {
+		opts.OnResult = jsonlWriter(os.Stdout, &cycle)
+	}
+
+	if *show {
+		infos, err := arpingall.ListInterfaces(opts)
+		if err != nil {
+			slog.Error("Error listing interfaces", "err", err)
+			os.Exit(exitCode(err))
+		}
+		if err := writeInterfaces(os.Stdout, infos); err != nil {
+			slog.Error("Error writing interfaces", "err", err)
+			os.Exit(exitFailed)
+		}
+		return
+	}
+	if *list {
+		planned, err := arpingall.Plan(opts)
+		if err != nil {
+			slog.Error("Error planning", "err", err)
+			os.Exit(exitCode(err))
+		}
+		if err := writeList(os.Stdout, planned); err != nil {
+			slog.Error("Error writing list", "err", err)
+			os.Exit(exitFailed)
+		}
+		return
+	}
+
+	var metricsMux *http.ServeMux
+	if *metricsAddr != "" {
+		metrics = arpingall.NewMetrics()
+		metricsMux = http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics)
+		if err := serve(*metricsAddr, metricsMux); err != nil {
+			slog.Error("Can't start metrics server", "err", err)
+			os.Exit(exitSetup)
+		}
+	}
+	if *healthAddr != "" {
+		health = &arpingall.Health{MaxAge: *healthMaxAge}
+		if health.MaxAge == 0 {
+			health.MaxAge = 2 * *loop
+		}
+		if *healthAddr == *metricsAddr {
+			metricsMux.Handle("/healthz", health)
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("/healthz", health)
+			if err := serve(*healthAddr, mux); err != nil {
+				slog.Error("Can't start health server", "err", err)
+				os.Exit(exitSetup)
+			}
+		}
+	}
+
+	// Stop starting announcements on the first signal; a second one kills
+	// us as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// reportRun reports each run of -watch and -loop, which keep going after
+	// a failed run. An interrupted run still reports what it sent.
+	reportRun := func(results arpingall.Results, err error) {
+		// Runs never overlap, so results of the next one see this.
+		defer func() { cycle++ }()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Error announcing", "err", err)
+			return
+		}
+		report(results)
+	}
+	if *loop > 0 {
+		arpingall.Loop(ctx, opts, *loop, reportRun)
+		return
+	}
+	if *watch {
+		err := arpingall.Watch(ctx, opts, reportRun)
+		if err != nil {
+			slog.Error("Can't watch for interface changes", "err", err)
+			os.Exit(exitSetup)
+		}
+		return
+	}
+
+	var results arpingall.Results
+	malformed := 0
+	if *stdin {
+		var pairs []arpingall.Pair
+		pairs, malformed, err = readPairs(os.Stdin)
+		if err != nil {
+			slog.Error("Can't read announcements from stdin", "err", err)
+			os.Exit(exitSetup)
+		}
+		results, err = arpingall.AnnouncePairs(ctx, opts, pairs)
+	} else {
+		results, err = arpingall.AnnounceAllContext(ctx, opts)
+	}
+	if errors.Is(err, context.Canceled) {
+		slog.Warn("Interrupted; not all announcements were sent")
+		report(results)
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		slog.Error("Error announcing", "err", err)
+		os.Exit(exitCode(err))
+	}
+
+	code := report(results)
+	if code == exitOK && malformed > 0 {
+		code = exitPartial
+	}
+	os.Exit(code)
+}
+
+// preflight checks that this process may send raw packets, having
+// CAP_NET_RAW or, where capabilities can't be read, being root, before any
+// announcement fails for lack of them. Most arpings are fine unprivileged,
+// being setuid or having the capability themselves, so that is only a
+// warning, unless -strict; -native always needs it.
+func preflight() error {
+	ok, err := arpingall.HasNetRaw()
+	if err != nil {
+		slog.Debug("Can't read capabilities; checking for root instead", "err", err)
+		ok = os.Geteuid() == 0
+	}
+	switch {
+	case ok:
+		return nil
+	case *native:
+		return errors.New("-native needs CAP_NET_RAW; run as root or give the binary the capability")
+	case *sudo:
+		return nil
+	case *strict:
+		return errors.New("no CAP_NET_RAW and -strict; use -sudo, or drop -strict if arping has the capability or is setuid")
+	}
+	slog.Warn("Not running with CAP_NET_RAW; arping will fail unless it has the capability or is setuid (see -sudo)")
+	return nil
+}
+
+// Values of -implementation.
+const (
+	implAuto     = "auto"
+	implNative   = "native"
+	implExternal = "external"
+)
+
+// chooseNative reports whether -implementation impl sends IPv4 announcements
+// natively, given whether we have CAP_NET_RAW, whether arping is usable and
+// whether a feature that only arping has, like -verify, is wanted.
+func chooseNative(impl string, netRaw, haveArping, needArping bool) (bool, error) {
+	switch impl {
+	case implNative:
+		return true, nil
+	case implExternal:
+		return false, nil
+	case implAuto:
+		switch {
+		case needArping && haveArping:
+			return false, nil
+		case needArping:
+			return false, errors.New("-verify and -dad need arping, and it isn't installed")
+		case netRaw:
+			return true, nil
+		case haveArping:
+			return false, nil
+		}
+		return false, errors.New("can't send natively without CAP_NET_RAW, and arping isn't installed")
+	}
+	return false, fmt.Errorf("must be auto, native or external, not %q", impl)
+}
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailed      = 1   // every announcement failed
+	exitPartial     = 2   // some announcements failed
+	exitSetup       = 3   // bad flags or config, or discovery failed
+	exitNotFound    = 127 // arping or ndsend not found, like the shell
+	exitInterrupted = 130 // stopped by a signal, like the shell
+)
+
+// exitCode returns the exit status for a run that failed with err before
+// announcing anything.
+func exitCode(err error) int {
+	if errors.Is(err, arpingall.ErrArpingNotFound) {
+		return exitNotFound
+	}
+	return exitSetup
+}
+
+// resultCode returns the exit status for a run that produced results.
+func resultCode(results arpingall.Results) int {
+	failed := results.Failed()
+	if *dryRun {
+		return exitOK
+	}
+	if len(failed) == 0 {
+		if len(unverified(results)) > 0 {
+			return exitPartial
+		}
+		return exitOK
+	}
+	for _, r := range failed {
+		if errors.Is(r.Err, arpingall.ErrArpingNotFound) {
+			return exitNotFound
+		}
+	}
+	if len(failed) == results.Attempted() {
+		return exitFailed
+	}
+	return exitPartial
+}
+
+// unverified returns the IPv4 announcements that were sent but whose gateway
+// didn't reply to -verify.
+func unverified(results arpingall.Results) []arpingall.Result {
+	if !*verify || *dryRun {
+		return nil
+	}
+	var list []arpingall.Result
+	for _, r := range results {
+		if r.Err == nil && r.Skipped == "" && r.SourceIP.To4() != nil && !r.Verified {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// serve starts an HTTP server for handler on addr in the background.
+func serve(addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := http.Serve(ln, handler)
+		slog.Error("HTTP server stopped", "addr", addr, "err", err)
+	}()
+	return nil
+}
+
+// report prints results as requested and summarizes them. It returns the exit
+// status for results.
+func report(results arpingall.Results) int {
+	if metrics != nil {
+		metrics.Observe(results)
+	}
+	if health != nil {
+		health.Observe(results)
+	}
+	var err error
+	switch *format {
+	case formatJSON:
+		err = writeJSON(os.Stdout, results)
+	case formatCSV:
+		err = writeCSV(os.Stdout, results)
+	}
+	if err != nil {
+		slog.Error("Error writing results", "format", *format, "err", err)
+		return exitFailed
+	}
+	summarize(results)
+	return resultCode(results)
+}
+
+// newLogger returns a logger writing to w at the level chosen by -v and -q.
+// It logs JSON along with -format json so that all output is machine
+// readable.
+func newLogger(w io.Writer, verbose, quiet, json bool) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbose:
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// summarize logs how many announcements succeeded and which ones failed.
+func summarize(results arpingall.Results) {
+	failed := results.Failed()
+	for _, r := range failed {
+		slog.Error("Failed", "addr", r.Addr, "source", r.SourceIP, "iface", r.Interface, "err", r.Err)
+	}
+	for _, r := range unverified(results) {
+		slog.Error("Not verified: gateway didn't reply", "addr", r.Addr, "source", r.SourceIP, "gateway", r.Gateway, "iface", r.Interface)
+	}
+	skipped := len(results.Skipped())
+	if *dryRun {
+		slog.Info(fmt.Sprintf("Would have sent %d announcements", results.Succeeded()), "skipped", skipped)
+		return
+	}
+	if *verify {
+		slog.Info(fmt.Sprintf("Sent %d of %d announcements", results.Succeeded(), results.Attempted()), "failed", len(failed), "skipped", skipped, "packets", results.PacketsSent(), "unverified", len(unverified(results)))
+		return
+	}
+	slog.Info(fmt.Sprintf("Sent %d of %d announcements", results.Succeeded(), results.Attempted()), "failed", len(failed), "skipped", skipped, "packets", results.PacketsSent())
+}
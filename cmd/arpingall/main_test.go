@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+func TestChooseNative(t *testing.T) {
+	tests := []struct {
+		impl                           string
+		netRaw, haveArping, needArping bool
+		native, ok                     bool
+	}{
+		{implNative, false, false, false, true, true},
+		{implNative, true, true, true, true, true}, // rejected later with -verify or -dad
+		{implExternal, true, true, false, false, true},
+		{implExternal, false, false, false, false, true},
+		{implAuto, true, true, false, true, true},
+		{implAuto, true, false, false, true, true},
+		{implAuto, false, true, false, false, true},
+		{implAuto, false, false, false, false, false},
+		{implAuto, true, true, true, false, true},
+		{implAuto, false, true, true, false, true},
+		{implAuto, true, false, true, false, false},
+		{"fast", true, true, false, false, false},
+	}
+	for _, tt := range tests {
+		native, err := chooseNative(tt.impl, tt.netRaw, tt.haveArping, tt.needArping)
+		if native != tt.native || (err == nil) != tt.ok {
+			t.Errorf("chooseNative(%q, netRaw %v, haveArping %v, needArping %v) = %v, %v; want %v, ok %v",
+				tt.impl, tt.netRaw, tt.haveArping, tt.needArping, native, err, tt.native, tt.ok)
+		}
+	}
+}
+
+func TestNewLoggerLevels(t *testing.T) {
+	for _, tt := range []struct {
+		verbose, quiet bool
+		lowest         slog.Level
+	}{
+		{false, false, slog.LevelInfo},
+		{true, false, slog.LevelDebug},
+		{false, true, slog.LevelError},
+		{true, true, slog.LevelError}, // -q wins
+	} {
+		logger := newLogger(io.Discard, tt.verbose, tt.quiet, false)
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+			if got, want := logger.Enabled(context.Background(), level), level >= tt.lowest; got != want {
+				t.Errorf("-v %v -q %v: level %s enabled %v, want %v", tt.verbose, tt.quiet, level, got, want)
+			}
+		}
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	for count, want := range map[int]time.Duration{1: 6 * time.Second, 3: 8 * time.Second, 30: 35 * time.Second} {
+		if got := defaultTimeout(count); got != want {
+			t.Errorf("defaultTimeout(%d) = %s, want %s", count, got, want)
+		}
+	}
+}
+
+func TestResultCode(t *testing.T) {
+	defer func(d, v bool) { *dryRun, *verify = d, v }(*dryRun, *verify)
+	ok := arpingall.Result{Interface: "eth0", SourceIP: net.ParseIP("192.0.2.10"), Attempts: 1}
+	failed := arpingall.Result{Interface: "eth1", SourceIP: net.ParseIP("198.51.100.7"), Attempts: 1,
+		Err: &arpingall.ErrArpingFailed{ExitCode: 2, Stderr: "arping: sendto: Network is unreachable\n"}}
+	notFound := arpingall.Result{Interface: "eth1", SourceIP: net.ParseIP("198.51.100.7"), Attempts: 1,
+		Err: fmt.Errorf("%w: exec: \"arping\": executable file not found in $PATH", arpingall.ErrArpingNotFound)}
+	skipped := arpingall.Result{Interface: "eth2", SourceIP: net.ParseIP("203.0.113.5"), Skipped: "no default gateway"}
+	verified := ok
+	verified.Verified = true
+
+	for _, tt := range []struct {
+		name           string
+		results        arpingall.Results
+		dryRun, verify bool
+		want           int
+	}{
+		{"all succeeded", arpingall.Results{ok, skipped}, false, false, exitOK},
+		{"all failed", arpingall.Results{failed, skipped}, false, false, exitFailed},
+		{"some failed", arpingall.Results{ok, failed, skipped}, false, false, exitPartial},
+		{"not installed", arpingall.Results{ok, notFound}, false, false, exitNotFound},
+		{"dry run", arpingall.Results{failed}, true, false, exitOK},
+		{"unverified", arpingall.Results{ok}, false, true, exitPartial},
+		{"verified", arpingall.Results{verified}, false, true, exitOK},
+	} {
+		*dryRun, *verify = tt.dryRun, tt.verify
+		if got := resultCode(tt.results); got != tt.want {
+			t.Errorf("%s: got exit code %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	if got := exitCode(errors.New("getting interfaces: permission denied")); got != exitSetup {
+		t.Errorf("setup error: got exit code %d, want %d", got, exitSetup)
+	}
+}
+
+func TestResultCodeStrict(t *testing.T) {
+	// What -strict makes of a run with one address announced and one
+	// without a gateway.
+	ok := arpingall.Result{Interface: "eth0", SourceIP: net.ParseIP("192.0.2.10"), Attempts: 1}
+	noGateway := arpingall.Result{Interface: "eth1", SourceIP: net.ParseIP("198.51.100.7"),
+		Err: fmt.Errorf("%w: no default gateway", arpingall.ErrSkipped)}
+	ipv6 := arpingall.Result{Interface: "eth0", SourceIP: net.ParseIP("2001:db8::10"), Skipped: "IPv6 announcements are disabled"}
+
+	if got := resultCode(arpingall.Results{ok, noGateway, ipv6}); got != exitPartial {
+		t.Errorf("got exit code %d, want %d", got, exitPartial)
+	}
+	if got := resultCode(arpingall.Results{noGateway, ipv6}); got != exitFailed {
+		t.Errorf("with nothing announced got exit code %d, want %d", got, exitFailed)
+	}
+}
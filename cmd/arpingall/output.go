@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+// Values of -format.
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJSONL = "jsonl" // JSON Lines, written as each result completes
+	formatCSV   = "csv"
+)
+
+// jsonResult is the JSON representation of an arpingall.Result.
+type jsonResult struct {
+	Interface    string   `json:"interface"`
+	Via          string   `json:"via,omitempty"`
+	SourceIP     string   `json:"source_ip"`
+	Gateway      string   `json:"gateway"`
+	Command      []string `json:"command"`
+	Output       string   `json:"output,omitempty"`
+	Stderr       string   `json:"stderr,omitempty"`
+	Success      bool     `json:"success"`
+	Error        string   `json:"error,omitempty"`
+	DurationMS   int64    `json:"duration_ms"`
+	Attempts     int      `json:"attempts"`
+	Packets      int      `json:"packets_sent"`
+	Skipped      string   `json:"skipped,omitempty"`
+	Verified     *bool    `json:"verified,omitempty"` // only with -verify
+	Conflict     bool     `json:"conflict,omitempty"`
+	GatewayState string   `json:"gateway_state,omitempty"` // only with -neigh-state
+}
+
+func newJSONResult(r arpingall.Result) jsonResult {
+	j := jsonResult{
+		Interface:    r.Interface,
+		Via:          r.Via,
+		SourceIP:     scoped(r.SourceIP, r.Interface),
+		Gateway:      scoped(r.Gateway, r.Interface),
+		Command:      r.Command,
+		Output:       r.Output,
+		Stderr:       r.Stderr,
+		Success:      r.Err == nil && r.Skipped == "",
+		DurationMS:   r.Duration.Milliseconds(),
+		Attempts:     r.Attempts,
+		Packets:      r.PacketsSent,
+		Skipped:      r.Skipped,
+		Conflict:     r.Conflict,
+		GatewayState: r.GatewayState,
+	}
+	if r.Err != nil {
+		j.Error = r.Err.Error()
+	}
+	if *verify && j.Success && r.SourceIP.To4() != nil {
+		j.Verified = &r.Verified
+	}
+	return j
+}
+
+// jsonlResult is a line of -format jsonl: a jsonResult with when it
+// completed and, with -loop or -watch, which run it was from, counting from
+// one.
+type jsonlResult struct {
+	Time  string `json:"time"`
+	Cycle int    `json:"cycle,omitempty"`
+	jsonResult
+}
+
+// jsonlWriter returns an Options.OnResult writing each result to w as a line
+// of JSON, straight away. *cycle is the number of runs before this one.
+func jsonlWriter(w io.Writer, cycle *int) func(arpingall.Result) {
+	enc := json.NewEncoder(w)
+	return func(r arpingall.Result) {
+		j := jsonlResult{Time: time.Now().Format(time.RFC3339Nano), jsonResult: newJSONResult(r)}
+		if *loop > 0 || *watch {
+			j.Cycle = *cycle + 1
+		}
+		if err := enc.Encode(j); err != nil {
+			slog.Error("Error writing result", "format", formatJSONL, "err", err)
+		}
+	}
+}
+
+// writeJSON writes results to w as a JSON array.
+func writeJSON(w io.Writer, results arpingall.Results) error {
+	list := make([]jsonResult, 0, len(results))
+	for _, r := range results {
+		list = append(list, newJSONResult(r))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
+
+// csvHeader names the columns written by writeCSV, which are the fields of
+// jsonResult.
+var csvHeader = []string{"interface", "via", "source_ip", "gateway", "command", "output", "stderr", "success", "error", "duration_ms", "attempts", "packets_sent", "skipped", "verified", "conflict", "gateway_state"}
+
+// writeCSV writes results to w as CSV with a header row, one row per result.
+func writeCSV(w io.Writer, results arpingall.Results) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, r := range results {
+		j := newJSONResult(r)
+		verified := ""
+		if j.Verified != nil {
+			verified = strconv.FormatBool(*j.Verified)
+		}
+		cw.Write([]string{
+			j.Interface, j.Via, j.SourceIP, j.Gateway, strings.Join(j.Command, " "),
+			j.Output, j.Stderr, strconv.FormatBool(j.Success), j.Error,
+			strconv.FormatInt(j.DurationMS, 10), strconv.Itoa(j.Attempts), strconv.Itoa(j.Packets),
+			j.Skipped, verified, strconv.FormatBool(j.Conflict), j.GatewayState,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeList writes planned as a table, one row per announcement or skip.
+func writeList(w io.Writer, planned []arpingall.Planned) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "INTERFACE\tADDRESS\tSOURCE\tGATEWAY\tACTION")
+	for _, p := range planned {
+		action := "announce"
+		if p.Skip != "" {
+			action = "skip: " + p.Skip
+		}
+		iface := p.Interface
+		if p.Via != "" {
+			iface += " via " + p.Via
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", iface, orDash(p.Addr), orDash(scoped(p.SourceIP, p.Interface)), orDash(scoped(p.Gateway, p.Interface)), action)
+	}
+	return tw.Flush()
+}
+
+// writeInterfaces writes infos as a table, one row per interface.
+func writeInterfaces(w io.Writer, infos []arpingall.InterfaceInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "INTERFACE\tMAC\tSTATE\tTYPE\tADDRESSES\tGATEWAY\tGATEWAY6\tROLE")
+	for _, i := range infos {
+		state := "down"
+		if i.Up {
+			state = "up"
+		}
+		role := "announce"
+		if i.Skip != "" {
+			role = "skip: " + i.Skip
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i.Name, orDash(i.MAC), state, i.Type,
+			orDash(strings.Join(i.Addrs, ",")), orDash(scoped(i.Gateway, i.Name)), orDash(scoped(i.Gateway6, i.Name)), role)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// scoped formats ip, adding the interface as its zone if it is IPv6
+// link-local, e.g. fe80::1%eth0. It returns "" for nil.
+func scoped(ip net.IP, iface string) string {
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() == nil && ip.IsLinkLocalUnicast():
+		return ip.String() + "%" + iface
+	}
+	return ip.String()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brandt/arpingall"
+)
+
+// mixedResults are a run's results: one success, one failure and one skip.
+var mixedResults = arpingall.Results{
+	{
+		Interface: "eth0", Addr: "192.0.2.10/24", SourceIP: net.ParseIP("192.0.2.10"), Gateway: net.ParseIP("192.0.2.1"),
+		Command: []string{"arping", "-U", "-c", "1", "-I", "eth0", "-s", "192.0.2.10", "192.0.2.1"},
+		Output:  "Sent 1 probes\n", Duration: 1500 * time.Millisecond, Attempts: 1, PacketsSent: 1,
+	},
+	{
+		Interface: "eth1", Addr: "198.51.100.7/24", SourceIP: net.ParseIP("198.51.100.7"), Gateway: net.ParseIP("198.51.100.1"),
+		Command: []string{"arping", "-U", "-c", "1", "-I", "eth1", "-s", "198.51.100.7", "198.51.100.1"},
+		Stderr:  "arping: eth1 is down\n", Err: errors.New("exit status 2: arping: eth1 is down"), Attempts: 1, PacketsSent: 1,
+	},
+	{
+		Interface: "eth2", Addr: "203.0.113.5/24", SourceIP: net.ParseIP("203.0.113.5"), Skipped: "no default gateway",
+	},
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, mixedResults); err != nil {
+		t.Fatal(err)
+	}
+	var got []jsonResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v in:\n%s", err, buf.String())
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d results, want 3", len(got))
+	}
+
+	ok, failed, skipped := got[0], got[1], got[2]
+	if !ok.Success || ok.Error != "" || ok.Interface != "eth0" || ok.SourceIP != "192.0.2.10" || ok.Gateway != "192.0.2.1" ||
+		ok.DurationMS != 1500 || ok.Packets != 1 || len(ok.Command) != 9 || ok.Output != "Sent 1 probes\n" {
+		t.Errorf("success: got %+v", ok)
+	}
+	if failed.Success || failed.Error != "exit status 2: arping: eth1 is down" || failed.Stderr != "arping: eth1 is down\n" {
+		t.Errorf("failure: got %+v", failed)
+	}
+	if skipped.Success || skipped.Skipped != "no default gateway" || skipped.Gateway != "" {
+		t.Errorf("skip: got %+v", skipped)
+	}
+}
+
+func TestWriteList(t *testing.T) {
+	planned := []arpingall.Planned{
+		{Interface: "eth0", Addr: "192.0.2.10/24", SourceIP: net.ParseIP("192.0.2.10"), Gateway: net.ParseIP("192.0.2.1")},
+		{Interface: "br0", Via: "eth1", Addr: "198.51.100.7/24", SourceIP: net.ParseIP("198.51.100.7"), Gateway: net.ParseIP("198.51.100.1")},
+		{Interface: "eth2", Addr: "fe80::10/64", SourceIP: net.ParseIP("fe80::10"), Gateway: net.ParseIP("fe80::1")},
+		{Interface: "eth3", Addr: "203.0.113.5/24", SourceIP: net.ParseIP("203.0.113.5"), Skip: "no default gateway"},
+		{Interface: "docker0", Skip: "excluded"},
+	}
+	var buf bytes.Buffer
+	if err := writeList(&buf, planned); err != nil {
+		t.Fatal(err)
+	}
+	want := `INTERFACE     ADDRESS          SOURCE         GATEWAY       ACTION
+eth0          192.0.2.10/24    192.0.2.10     192.0.2.1     announce
+br0 via eth1  198.51.100.7/24  198.51.100.7   198.51.100.1  announce
+eth2          fe80::10/64      fe80::10%eth2  fe80::1%eth2  announce
+eth3          203.0.113.5/24   203.0.113.5    -             skip: no default gateway
+docker0       -                -              -             skip: excluded
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, mixedResults); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || !reflect.DeepEqual(rows[0], csvHeader) {
+		t.Fatalf("got %d rows with header %q, want 4 with %q", len(rows), rows[0], csvHeader)
+	}
+
+	field := func(row int, name string) string {
+		for col, n := range csvHeader {
+			if n == name {
+				return rows[row][col]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	for _, tt := range []struct {
+		row        int
+		name, want string
+	}{
+		{1, "interface", "eth0"},
+		{1, "source_ip", "192.0.2.10"},
+		{1, "gateway", "192.0.2.1"},
+		{1, "command", "arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1"},
+		{1, "success", "true"},
+		{1, "duration_ms", "1500"},
+		{1, "packets_sent", "1"},
+		{2, "success", "false"},
+		{2, "error", "exit status 2: arping: eth1 is down"},
+		{2, "stderr", "arping: eth1 is down\n"},
+		{3, "skipped", "no default gateway"},
+		{3, "gateway", ""},
+		{3, "verified", ""}, // only with -verify
+	} {
+		if got := field(tt.row, tt.name); got != tt.want {
+			t.Errorf("row %d, %s: got %q, want %q", tt.row, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	defer func(d time.Duration) { *loop = d }(*loop)
+	for _, tt := range []struct {
+		loop  time.Duration
+		cycle int // the previous runs
+		want  int
+	}{
+		{0, 0, 0}, // a single run has no cycle
+		{time.Minute, 2, 3},
+	} {
+		*loop = tt.loop
+		var buf bytes.Buffer
+		cycle := tt.cycle
+		write := jsonlWriter(&buf, &cycle)
+		for _, r := range mixedResults {
+			write(r)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(mixedResults) {
+			t.Fatalf("got %d lines, want one per result:\n%s", len(lines), buf.String())
+		}
+		for n, line := range lines {
+			var got jsonlResult
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("line %d: %v: %s", n+1, err, line)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, got.Time); err != nil {
+				t.Errorf("line %d: bad time: %v", n+1, err)
+			}
+			if got.Interface != mixedResults[n].Interface || got.Cycle != tt.want {
+				t.Errorf("line %d: got interface %s in cycle %d, want %s in %d", n+1, got.Interface, got.Cycle, mixedResults[n].Interface, tt.want)
+			}
+		}
+	}
+}
+
+func TestWriteInterfaces(t *testing.T) {
+	infos := []arpingall.InterfaceInfo{
+		{
+			Interface: arpingall.Interface{Name: "eth0", MAC: "02:00:00:00:00:01", Addrs: []string{"192.0.2.10/24", "fe80::10/64"}},
+			Up:        true, Type: "ethernet", Gateway: net.ParseIP("192.0.2.1"), Gateway6: net.ParseIP("fe80::1"),
+		},
+		{
+			Interface: arpingall.Interface{Name: "br0", MAC: "02:00:00:00:00:02", Addrs: []string{"198.51.100.7/24"}},
+			Up:        true, Type: "bridge", Skip: "excluded",
+		},
+		{Interface: arpingall.Interface{Name: "lo", Addrs: []string{"127.0.0.1/8"}}, Up: true, Type: "loopback", Skip: "loopback interface"},
+		{Interface: arpingall.Interface{Name: "eth1", MAC: "02:00:00:00:00:03"}, Type: "ethernet", Skip: "interface is down"},
+	}
+	var buf bytes.Buffer
+	if err := writeInterfaces(&buf, infos); err != nil {
+		t.Fatal(err)
+	}
+	want := `INTERFACE  MAC                STATE  TYPE      ADDRESSES                  GATEWAY    GATEWAY6      ROLE
+eth0       02:00:00:00:00:01  up     ethernet  192.0.2.10/24,fe80::10/64  192.0.2.1  fe80::1%eth0  announce
+br0        02:00:00:00:00:02  up     bridge    198.51.100.7/24            -          -             skip: excluded
+lo         -                  up     loopback  127.0.0.1/8                -          -             skip: loopback interface
+eth1       02:00:00:00:00:03  down   ethernet  -                          -          -             skip: interface is down
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
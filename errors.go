@@ -0,0 +1,75 @@
+package arpingall
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrNoGateway is returned when there were addresses to announce but
+	// none of their interfaces has a gateway to announce them to. It is not
+	// returned when there are no default routes at all, as in a minimal
+	// network namespace; that is only logged.
+	ErrNoGateway = errors.New("no gateway found")
+
+	// ErrInterfaceDown is matched by announcements that failed because
+	// their interface is down.
+	ErrInterfaceDown = errors.New("interface is down")
+
+	// ErrDuplicateAddress is returned with Options.Strict when an IPv4
+	// address is assigned to more than one interface, whose announcements
+	// would conflict.
+	ErrDuplicateAddress = errors.New("address assigned to more than one interface")
+
+	// ErrSkipped is matched by the failures of IPv4 addresses that
+	// Options.Strict wouldn't let be skipped, such as one without a gateway.
+	ErrSkipped = errors.New("address can't be announced")
+
+	// ErrAddressConflict is matched by announcements not made because
+	// Options.DAD found another host using their source address.
+	ErrAddressConflict = errors.New("address is in use by another host")
+
+	// ErrArpingNotFound is matched by announcements that failed because the
+	// arping (or ndsend) command couldn't be found.
+	ErrArpingNotFound = errors.New("arping not found")
+)
+
+// ErrArpingFailed is the error of an announcement whose command ran and
+// exited unsuccessfully.
+type ErrArpingFailed struct {
+	ExitCode int // -1 if it was killed by a signal
+	Stderr   string
+}
+
+func (e *ErrArpingFailed) Error() string {
+	msg := fmt.Sprintf("exit status %d", e.ExitCode)
+	if e.ExitCode < 0 {
+		msg = "killed"
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Is lets errors.Is(err, ErrInterfaceDown) match arping complaining that the
+// interface is down.
+func (e *ErrArpingFailed) Is(target error) bool {
+	return target == ErrInterfaceDown && strings.Contains(e.Stderr, "is down")
+}
+
+// commandError converts an error from running a command that wrote stderr
+// into one of the typed errors above, leaving other errors alone.
+func commandError(err error, stderr []byte) error {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return &ErrArpingFailed{ExitCode: exitErr.ExitCode(), Stderr: string(stderr)}
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %w", ErrArpingNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// exitError returns the error of a command that exited with status 2.
+func exitError(t *testing.T) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", "exit 2").Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("sh -c 'exit 2': %v", err)
+	}
+	return err
+}
+
+func TestCommandError(t *testing.T) {
+	err := commandError(exitError(t), []byte("arping: Interface \"eth0\" is down\n"))
+	var failed *ErrArpingFailed
+	if !errors.As(err, &failed) {
+		t.Fatalf("got %T %v, want an *ErrArpingFailed", err, err)
+	}
+	if failed.ExitCode != 2 || failed.Stderr != "arping: Interface \"eth0\" is down\n" {
+		t.Errorf("got exit code %d, stderr %q", failed.ExitCode, failed.Stderr)
+	}
+	if !errors.Is(err, ErrInterfaceDown) {
+		t.Errorf("%v doesn't match ErrInterfaceDown", err)
+	}
+
+	err = commandError(exitError(t), []byte("arping: sendto: Network is unreachable\n"))
+	if errors.Is(err, ErrInterfaceDown) {
+		t.Errorf("%v matches ErrInterfaceDown", err)
+	}
+
+	notFound := &exec.Error{Name: "arping", Err: exec.ErrNotFound}
+	if err := commandError(notFound, nil); !errors.Is(err, ErrArpingNotFound) || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("got %v, want ErrArpingNotFound wrapping exec.ErrNotFound", err)
+	}
+
+	other := errors.New("something else")
+	if err := commandError(other, nil); err != other {
+		t.Errorf("got %v, want %v unchanged", err, other)
+	}
+}
+
+func TestAnnounceErrorTypes(t *testing.T) {
+	exit := exitError(t)
+	for _, tt := range []struct {
+		name   string
+		err    error
+		stderr string
+		want   error
+	}{
+		{"not installed", &exec.Error{Name: "arping", Err: exec.ErrNotFound}, "", ErrArpingNotFound},
+		{"interface down", exit, "arping: Interface \"eth0\" is down\n", ErrInterfaceDown},
+	} {
+		r := &fakeRunner{run: func(context.Context, []string) (string, string, error) { return "", tt.stderr, tt.err }}
+		opts := testOptions(t, r, Options{})
+		results, _ := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:1], threeRoutes[:1]))
+		if len(results) != 1 || !errors.Is(results[0].Err, tt.want) {
+			t.Errorf("%s: got %v, want an error matching %v", tt.name, results, tt.want)
+		}
+	}
+
+	// A failing command gives its exit code and stderr.
+	r := &fakeRunner{run: func(context.Context, []string) (string, string, error) { return "", "arping: unknown error\n", exit }}
+	opts := testOptions(t, r, Options{})
+	results, _ := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:1], threeRoutes[:1]))
+	var failed *ErrArpingFailed
+	if len(results) != 1 || !errors.As(results[0].Err, &failed) || failed.ExitCode != 2 || failed.Stderr != "arping: unknown error\n" {
+		t.Errorf("got %v, want an *ErrArpingFailed with exit code 2", results)
+	}
+}
+
+func TestPlanErrorTypes(t *testing.T) {
+	// eth1 has no default route, but eth0, which isn't announced on, does.
+	opts := testOptions(t, &fakeRunner{}, Options{})
+	if _, _, err := planning(opts, threeInterfaces[1:2], threeRoutes[:1])(); !errors.Is(err, ErrNoGateway) {
+		t.Errorf("got %v, want ErrNoGateway", err)
+	}
+
+	// With Strict, eth1 fails rather than being skipped.
+	opts = testOptions(t, &fakeRunner{}, Options{Strict: true})
+	results, _ := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:2], threeRoutes[:1]))
+	if failed := results.Failed(); len(failed) != 1 || failed[0].Interface != "eth1" || !errors.Is(failed[0].Err, ErrSkipped) {
+		t.Errorf("got failures %v, want eth1 matching ErrSkipped", failed)
+	}
+}
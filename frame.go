@@ -0,0 +1,68 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+const (
+	etherTypeARP  = 0x0806
+	etherTypeIPv4 = 0x0800
+	etherTypeVLAN = 0x8100 // 802.1Q tag protocol identifier
+	arpHTypeEther = 1
+
+	arpRequest = 1
+	arpReply   = 2
+
+	// Minimum Ethernet frame length, excluding the frame check sequence.
+	minFrameLen = 60
+)
+
+var broadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// arpFrame builds an Ethernet frame carrying a gratuitous ARP packet with
+// operation op, sent from srcMAC/srcIP and targeting dstIP. It is broadcast,
+// unless dstMAC is set, which is then both the destination and the target
+// MAC:
+//
+//	dst MAC | src MAC | 0x0806 | htype | ptype | hlen | plen | op |
+//	sender MAC | sender IP | target MAC | target IP | padding
+func arpFrame(op uint16, srcMAC, dstMAC net.HardwareAddr, srcIP, dstIP net.IP) []byte {
+	if dstMAC == nil {
+		dstMAC = broadcastMAC
+	}
+	b := make([]byte, 0, minFrameLen)
+
+	// Ethernet header
+	b = append(b, dstMAC...)
+	b = append(b, srcMAC...)
+	b = binary.BigEndian.AppendUint16(b, etherTypeARP)
+
+	// ARP packet
+	b = binary.BigEndian.AppendUint16(b, arpHTypeEther)
+	b = binary.BigEndian.AppendUint16(b, etherTypeIPv4)
+	b = append(b, byte(len(srcMAC)), net.IPv4len)
+	b = binary.BigEndian.AppendUint16(b, op)
+	b = append(b, srcMAC...)
+	b = append(b, srcIP.To4()...)
+	b = append(b, dstMAC...)
+	b = append(b, dstIP.To4()...)
+
+	// Pad to the minimum frame length so drivers don't have to.
+	for len(b) < minFrameLen {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// vlanTag returns frame with an 802.1Q tag for VLAN id inserted after the MAC
+// addresses, for sending on the VLAN's parent interface:
+//
+//	dst MAC | src MAC | 0x8100 | priority, DEI, id | ethertype | ...
+func vlanTag(frame []byte, id int) []byte {
+	b := make([]byte, 0, len(frame)+4)
+	b = append(b, frame[:12]...)
+	b = binary.BigEndian.AppendUint16(b, etherTypeVLAN)
+	b = binary.BigEndian.AppendUint16(b, uint16(id)&0x0fff)
+	return append(b, frame[12:]...)
+}
@@ -0,0 +1,105 @@
+package arpingall
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+)
+
+// hexDump decodes a hex dump, ignoring whitespace.
+func hexDump(t *testing.T, dump string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(dump), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+var (
+	testMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	testSrc = net.ParseIP("192.0.2.10")
+	testGW  = net.ParseIP("192.0.2.1")
+)
+
+func TestARPFrame(t *testing.T) {
+	want := hexDump(t, `
+		ffffffffffff 020000000001 0806
+		0001 0800 06 04 0001
+		020000000001 c000020a
+		ffffffffffff c0000201
+		000000000000000000000000000000000000
+	`)
+	if got := arpFrame(arpRequest, testMAC, nil, testSrc, testGW); string(got) != string(want) {
+		t.Errorf("got frame\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestARPFrameReply(t *testing.T) {
+	frame := arpFrame(arpReply, testMAC, nil, testSrc, testGW)
+	if op := frame[20:22]; op[0] != 0 || op[1] != 2 {
+		t.Errorf("got operation %x, want 0002 (reply)", op)
+	}
+}
+
+func TestVLANFrame(t *testing.T) {
+	want := hexDump(t, `
+		ffffffffffff 020000000001 8100 0064 0806
+		0001 0800 06 04 0001
+		020000000001 c000020a
+		ffffffffffff c0000201
+		000000000000000000000000000000000000
+	`)
+	if got := vlanTag(arpFrame(arpRequest, testMAC, nil, testSrc, testGW), 100); string(got) != string(want) {
+		t.Errorf("got frame\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestARPFrameSourceMAC(t *testing.T) {
+	// The MAC of the host that failed over, in place of the interface's.
+	oldMAC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0xbe, 0xef}
+	frame := arpFrame(arpRequest, oldMAC, nil, testSrc, testGW)
+	if src := net.HardwareAddr(frame[6:12]); src.String() != oldMAC.String() {
+		t.Errorf("got Ethernet source %s, want %s", src, oldMAC)
+	}
+	if sender := net.HardwareAddr(frame[22:28]); sender.String() != oldMAC.String() {
+		t.Errorf("got ARP sender hardware address %s, want %s", sender, oldMAC)
+	}
+}
+
+func TestARPFrameTargetMAC(t *testing.T) {
+	gwMAC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x01, 0x01}
+	frame := arpFrame(arpRequest, testMAC, gwMAC, testSrc, testGW)
+	if dst := net.HardwareAddr(frame[0:6]); dst.String() != gwMAC.String() {
+		t.Errorf("got Ethernet destination %s, want %s", dst, gwMAC)
+	}
+	if target := net.HardwareAddr(frame[32:38]); target.String() != gwMAC.String() {
+		t.Errorf("got ARP target hardware address %s, want %s", target, gwMAC)
+	}
+}
+
+func TestTargetMAC(t *testing.T) {
+	neighbors := []Neighbor{
+		{IP: net.ParseIP("192.0.2.1").To4(), MAC: "02:00:00:00:01:01", Interface: "eth0", Flags: atfCom},
+		{IP: net.ParseIP("192.0.2.1").To4(), MAC: "02:00:00:00:02:01", Interface: "eth9", Flags: atfCom},
+	}
+	a := announcement{iface: ethernet(2, "eth0", "192.0.2.10/24"), source: testSrc, gateway: testGW}
+	fixed := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0xbe, 0xef}
+	for _, tt := range []struct {
+		name string
+		opts Options
+		a    announcement
+		want string
+	}{
+		{"broadcast", Options{}, a, ""},
+		{"given", Options{TargetMAC: fixed}, a, "02:00:00:00:be:ef"},
+		{"auto", Options{TargetMACAuto: true}, a, "02:00:00:00:01:01"},
+		{"auto, not cached", Options{TargetMACAuto: true}, announcement{iface: a.iface, source: testSrc, gateway: net.ParseIP("192.0.2.254")}, ""},
+	} {
+		tt.opts.Logger = discardLogger
+		if got := targetMAC(tt.opts, tt.a, neighbors).String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/brandt/arpingall
+
+go 1.21
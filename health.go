@@ -0,0 +1,45 @@
+package arpingall
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health tracks when the last run completed. It is an http.Handler for a
+// liveness probe, answering 200 OK if a run completed within MaxAge and 503
+// Service Unavailable otherwise, including before the first run.
+type Health struct {
+	// MaxAge is how long ago the last run may have completed. Zero means
+	// any completed run is recent enough.
+	MaxAge time.Duration
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// Observe records that a run completed.
+func (h *Health) Observe(Results) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastRun = time.Now()
+}
+
+func (h *Health) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	lastRun, age := h.lastRun, time.Since(h.lastRun)
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case lastRun.IsZero():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "no run completed yet")
+	case h.MaxAge > 0 && age > h.MaxAge:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "last run completed %s ago\n", age.Round(time.Millisecond))
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
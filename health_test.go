@@ -0,0 +1,40 @@
+package arpingall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probe returns the status and body of a request to h.
+func probe(h *Health) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealth(t *testing.T) {
+	h := &Health{MaxAge: time.Minute}
+	if code, body := probe(h); code != http.StatusServiceUnavailable || body != "no run completed yet\n" {
+		t.Errorf("before the first run: got %d %q", code, body)
+	}
+
+	h.Observe(nil)
+	if code, body := probe(h); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("after a run: got %d %q", code, body)
+	}
+
+	// The last run was longer ago than MaxAge.
+	h.lastRun = time.Now().Add(-2 * time.Minute)
+	if code, body := probe(h); code != http.StatusServiceUnavailable || !strings.HasPrefix(body, "last run completed 2m0") {
+		t.Errorf("after a stale run: got %d %q", code, body)
+	}
+
+	// Without MaxAge, any run is recent enough.
+	h.MaxAge = 0
+	if code, _ := probe(h); code != http.StatusOK {
+		t.Errorf("stale run without MaxAge: got %d", code)
+	}
+}
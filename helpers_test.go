@@ -0,0 +1,108 @@
+package arpingall
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// discardLogger logs nothing, for tests that don't look at the logs.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeRunner is a Runner recording the commands it is given instead of
+// running them. Each is answered by run, or with no output if run is nil. It
+// also counts how many run at once.
+type fakeRunner struct {
+	run func(ctx context.Context, argv []string) (stdout, stderr string, err error)
+
+	mu         sync.Mutex
+	calls      []string // each command line, joined by spaces, in order
+	running    int
+	maxRunning int
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	argv := append([]string{name}, args...)
+	f.mu.Lock()
+	f.calls = append(f.calls, strings.Join(argv, " "))
+	f.running++
+	f.maxRunning = max(f.maxRunning, f.running)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	if f.run == nil {
+		return nil, nil, nil
+	}
+	stdout, stderr, err := f.run(ctx, argv)
+	return []byte(stdout), []byte(stderr), err
+}
+
+func (f *fakeRunner) RunStream(ctx context.Context, w io.Writer, name string, args ...string) ([]byte, []byte, error) {
+	stdout, stderr, err := f.Run(ctx, name, args...)
+	w.Write(stdout)
+	w.Write(stderr)
+	return stdout, stderr, err
+}
+
+// commands returns the command lines run so far.
+func (f *fakeRunner) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// testOptions returns opts prepared to run commands with r, as iputils
+// arping, discarding their output and the logs unless opts says otherwise.
+func testOptions(t *testing.T, r Runner, opts Options) Options {
+	t.Helper()
+	opts.Runner = r
+	if opts.Variant == VariantUnknown {
+		opts.Variant = VariantIputils
+	}
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+	if opts.Logger == nil {
+		opts.Logger = discardLogger
+	}
+	opts, err := prepare(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// planning returns the find function of announceAll for ifaces and routes,
+// which may mix families, in place of discovering the host's.
+func planning(opts Options, ifaces []Interface, routes []Route) func() ([]announcement, []Planned, error) {
+	return func() ([]announcement, []Planned, error) {
+		routes4, routes6 := splitFamilies(routes)
+		return plan(opts, ifaces, routes4, routes6, nil)
+	}
+}
+
+// ethernet returns an Ethernet interface with the given index, name and
+// addresses, in CIDR notation.
+func ethernet(index int, name string, addrs ...string) Interface {
+	return Interface{Index: index, Name: name, MAC: fmt.Sprintf("02:00:00:00:00:%02x", index), Addrs: addrs}
+}
+
+// defaultRoute returns an up default route on iface via gw.
+func defaultRoute(iface, gw string, metric int) Route {
+	r := Route{Interface: iface, Gateway: net.ParseIP(gw), Flags: RTF_UP | RTF_GATEWAY, Metric: metric, Table: TableMain}
+	if ip := r.Gateway.To4(); ip != nil {
+		r.Destination, r.Gateway, r.Mask = net.IPv4zero.To4(), ip, net.CIDRMask(0, 8*net.IPv4len)
+	} else {
+		r.Destination, r.Mask = net.IPv6unspecified, net.CIDRMask(0, 8*net.IPv6len)
+	}
+	return r
+}
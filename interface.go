@@ -0,0 +1,248 @@
+package arpingall
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// Interface is a local interface and the addresses that can be announced on
+// it.
+type Interface struct {
+	Index int
+	Name  string
+	MAC   string
+	Addrs []string // CIDR notation, e.g. 192.0.2.10/24
+	VLAN  VLAN     // zero unless this is a VLAN sub-interface
+
+	BridgeMembers []string // ports, if this is a bridge
+}
+
+// HasAddr reports whether ip is one of the addresses assigned to i.
+func (i Interface) HasAddr(ip net.IP) bool {
+	for _, addr := range i.Addrs {
+		if a, _, err := net.ParseCIDR(addr); err == nil && a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter selects which interfaces to announce on. Include and Exclude hold
+// names or shell glob patterns such as "veth*", or with Regex, regular
+// expressions that must match the whole name. A name equal to an entry always
+// matches it, whatever its special characters. IncludeLoopback and
+// IncludePointToPoint need neither AllTypes nor IncludeZeroMAC, although
+// neither kind is Ethernet and a loopback's MAC is all zeros.
+type Filter struct {
+	Include             []string // only these interfaces, if non-empty
+	Exclude             []string // never these interfaces; wins over Include
+	Regex               bool     // Include and Exclude are regular expressions
+	IncludeDown         bool
+	IncludeLoopback     bool
+	IncludePointToPoint bool
+	IncludeZeroMAC      bool // interfaces whose MAC is 00:00:00:00:00:00
+	AllTypes            bool // interfaces that aren't Ethernet, e.g. tunnels
+	MinMTU              int  // skip interfaces with a smaller MTU, if positive
+}
+
+// skipReason returns why i should be skipped, or "" if it should be used.
+// Exclusion wins over inclusion.
+func (f Filter) skipReason(i net.Interface) string {
+	switch {
+	case f.matchAny(f.Exclude, i.Name):
+		return "excluded"
+	case len(f.Include) > 0 && !f.matchAny(f.Include, i.Name):
+		return "not included"
+	case !f.IncludeZeroMAC && !f.includesFlags(i) && hasZeroMAC(i):
+		// Some virtual interfaces report one; arping fails on them.
+		return "all-zero MAC address"
+	case !f.AllTypes && !f.includesFlags(i) && nonEthernet(i.Name):
+		return "not an Ethernet interface"
+	case f.MinMTU > 0 && i.MTU < f.MinMTU:
+		return fmt.Sprintf("MTU %d is below %d", i.MTU, f.MinMTU)
+	case i.Flags&net.FlagUp == 0 && !f.IncludeDown:
+		return "interface is down"
+	case i.Flags&net.FlagLoopback != 0 && !f.IncludeLoopback:
+		return "loopback interface"
+	case i.Flags&net.FlagPointToPoint != 0 && !f.IncludePointToPoint:
+		return "point-to-point interface"
+	}
+	return ""
+}
+
+// includesFlags reports whether IncludeLoopback or IncludePointToPoint asks
+// for i, whose link type is then not Ethernet either, and whose MAC, if any,
+// is all zeros.
+func (f Filter) includesFlags(i net.Interface) bool {
+	return i.Flags&net.FlagLoopback != 0 && f.IncludeLoopback ||
+		i.Flags&net.FlagPointToPoint != 0 && f.IncludePointToPoint
+}
+
+// compiledPatterns caches the compiled form of every regular expression used
+// by a Filter, which are few and used on every discovery.
+var compiledPatterns sync.Map // string to *regexp.Regexp
+
+// matchAny reports whether name matches one of the patterns.
+func (f Filter) matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name || f.match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether name matches pattern. Invalid patterns, which check
+// rejects, match nothing.
+func (f Filter) match(pattern, name string) bool {
+	if !f.Regex {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	re, err := compilePattern(pattern)
+	return err == nil && re.MatchString(name)
+}
+
+// compilePattern compiles pattern to match whole names, once.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := compiledPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// check reports the first invalid pattern in f.
+func (f Filter) check() error {
+	if f.MinMTU < 0 {
+		return fmt.Errorf("minimum MTU %d is negative", f.MinMTU)
+	}
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		var err error
+		if f.Regex {
+			_, err = compilePattern(p)
+		} else {
+			_, err = path.Match(p, "")
+		}
+		if err != nil {
+			return fmt.Errorf("interface pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// zeroMAC reports whether mac is non-empty and all zeros.
+func zeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return len(mac) > 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Interfaces returns every local interface with a MAC address that passes f.
+func Interfaces(f Filter) ([]Interface, error) {
+	return interfaces(f, slog.Default())
+}
+
+// interfaces is Interfaces logging to logger.
+func interfaces(f Filter, logger *slog.Logger) ([]Interface, error) {
+	var interfaceList []Interface
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logger.Error("Can't list interfaces", "err", err)
+		return interfaceList, err
+	}
+
+	for _, i := range ifaces {
+		if iface, ok := interfaceFrom(i, f, logger); ok {
+			interfaceList = append(interfaceList, iface)
+		}
+	}
+
+	return interfaceList, nil
+}
+
+// skipNoAddrs is why an interface that is otherwise selected has nothing to
+// announce.
+const skipNoAddrs = "no addresses"
+
+// skippedInterfaces returns an entry for every interface with a MAC address
+// that f rejects, saying why.
+func skippedInterfaces(f Filter) []Planned {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var skipped []Planned
+	for _, i := range ifaces {
+		if i.HardwareAddr.String() == "" {
+			continue
+		}
+		if reason := f.skipReason(i); reason != "" {
+			skipped = append(skipped, Planned{Interface: i.Name, Skip: reason, SkipKind: SkipDeliberate})
+		}
+	}
+	return skipped
+}
+
+// interfaceFrom returns i and its addresses, or false if it has no MAC address
+// or doesn't pass f.
+func interfaceFrom(i net.Interface, f Filter, logger *slog.Logger) (Interface, bool) {
+	// Skip interfaces that don't have a MAC address
+	if i.HardwareAddr.String() == "" {
+		return Interface{}, false
+	}
+
+	if reason := f.skipReason(i); reason != "" {
+		logger.Debug("Skipping interface", "iface", i.Name, "reason", reason)
+		return Interface{}, false
+	}
+
+	iface, err := describe(i, logger)
+	if err != nil {
+		logger.Warn("Can't list interface addresses", "iface", i.Name, "err", err)
+		return Interface{}, false
+	}
+	return iface, true
+}
+
+// describe returns i with its addresses, VLAN and bridge members.
+func describe(i net.Interface, logger *slog.Logger) (Interface, error) {
+	addrs, err := i.Addrs()
+	if err != nil {
+		return Interface{}, err
+	}
+
+	iface := Interface{Index: i.Index, Name: i.Name, MAC: i.HardwareAddr.String()}
+	if vlan, ok := lookupVLAN(i.Name); ok {
+		logger.Debug("Interface is a VLAN", "iface", i.Name, "vlan", vlan.ID, "parent", vlan.Parent)
+		iface.VLAN = vlan
+	}
+	for _, a := range addrs {
+		iface.Addrs = append(iface.Addrs, a.String())
+	}
+	if iface.BridgeMembers, err = bridgeMembers(i.Name); err != nil {
+		logger.Warn("Can't list bridge members", "iface", i.Name, "err", err)
+	}
+	return iface, nil
+}
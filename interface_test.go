@@ -0,0 +1,253 @@
+package arpingall
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// netInterface returns an Ethernet interface named name with flags, as
+// net.Interfaces would list it.
+func netInterface(name string, flags net.Flags) net.Interface {
+	return net.Interface{Index: 1, Name: name, MTU: 1500, HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}, Flags: flags}
+}
+
+// selected returns the names of the interfaces in ifaces that f selects.
+func selected(f Filter, ifaces []net.Interface) []string {
+	var names []string
+	for _, i := range ifaces {
+		if f.skipReason(i) == "" {
+			names = append(names, i.Name)
+		}
+	}
+	return names
+}
+
+func TestFilterIncludeExclude(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	ifaces := []net.Interface{netInterface("lan0", up), netInterface("lan1", up), netInterface("wan0", up)}
+	for _, tt := range []struct {
+		f    Filter
+		want []string
+	}{
+		{Filter{}, []string{"lan0", "lan1", "wan0"}},
+		{Filter{Include: []string{"lan0", "lan1"}}, []string{"lan0", "lan1"}},
+		{Filter{Exclude: []string{"wan0"}}, []string{"lan0", "lan1"}},
+		{Filter{Include: []string{"lan0", "lan1"}, Exclude: []string{"lan1"}}, []string{"lan0"}},
+		{Filter{Include: []string{"lan9"}}, nil},
+	} {
+		if got := selected(tt.f, ifaces); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("include %q, exclude %q: got %q, want %q", tt.f.Include, tt.f.Exclude, got, tt.want)
+		}
+	}
+	if reason := (Filter{Include: []string{"lan0"}, Exclude: []string{"lan0"}}).skipReason(ifaces[0]); reason != "excluded" {
+		t.Errorf("got %q for an interface both included and excluded, want excluded", reason)
+	}
+}
+
+func TestFilterSkipsDown(t *testing.T) {
+	ifaces := []net.Interface{
+		netInterface("lan0", net.FlagUp|net.FlagBroadcast|net.FlagRunning),
+		netInterface("lan1", net.FlagBroadcast),
+	}
+	if got := selected(Filter{}, ifaces); !reflect.DeepEqual(got, []string{"lan0"}) {
+		t.Errorf("got %q, want only lan0, which is up", got)
+	}
+	if reason := (Filter{}).skipReason(ifaces[1]); reason != "interface is down" {
+		t.Errorf("got reason %q for a down interface", reason)
+	}
+	if got := selected(Filter{IncludeDown: true}, ifaces); len(got) != 2 {
+		t.Errorf("got %q with IncludeDown, want both", got)
+	}
+}
+
+func TestFilterSkipsLoopbackAndPointToPoint(t *testing.T) {
+	lo := net.Interface{Index: 1, Name: "testlo0", MTU: 65536, HardwareAddr: net.HardwareAddr{0, 0, 0, 0, 0, 1}, Flags: net.FlagUp | net.FlagLoopback}
+	tun := netInterface("testppp0", net.FlagUp|net.FlagPointToPoint)
+	for _, tt := range []struct {
+		f    Filter
+		i    net.Interface
+		want string
+	}{
+		{Filter{}, lo, "loopback interface"},
+		{Filter{IncludeLoopback: true}, lo, ""},
+		{Filter{}, tun, "point-to-point interface"},
+		{Filter{IncludePointToPoint: true}, tun, ""},
+	} {
+		if got := tt.f.skipReason(tt.i); got != tt.want {
+			t.Errorf("%s with %+v: got reason %q, want %q", tt.i.Name, tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceHasAddr(t *testing.T) {
+	i := ethernet(2, "eth0", "192.0.2.10/24", "2001:db8::10/64", "bogus")
+	for ip, want := range map[string]bool{
+		"192.0.2.10":   true,
+		"2001:db8::10": true,
+		"192.0.2.11":   false, // same subnet, not assigned
+		"198.51.100.7": false,
+	} {
+		if got := i.HasAddr(net.ParseIP(ip)); got != want {
+			t.Errorf("HasAddr(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// A source fed in that the interface doesn't have is refused.
+	pair := Pair{Interface: "eth0", Source: net.ParseIP("192.0.2.11"), Gateway: net.ParseIP("192.0.2.1")}
+	if _, err := newAnnouncement(Options{Family: FamilyIPv4}, i, pair); err == nil {
+		t.Error("announced a source not assigned to the interface")
+	}
+}
+
+func TestFilterSkipsZeroMAC(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	zero := netInterface("testzero0", up)
+	zero.HardwareAddr = net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	ifaces := []net.Interface{netInterface("lan0", up), zero}
+
+	if got, want := selected(Filter{}, ifaces), []string{"lan0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if reason := (Filter{}).skipReason(zero); reason != "all-zero MAC address" {
+		t.Errorf("got skip reason %q", reason)
+	}
+	if got, want := selected(Filter{IncludeZeroMAC: true}, ifaces), []string{"lan0", "testzero0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with IncludeZeroMAC got %q, want %q", got, want)
+	}
+}
+
+func TestDescribeIndex(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ifaces) == 0 {
+		t.Skip("no interfaces")
+	}
+	for _, i := range ifaces {
+		iface, err := describe(i, discardLogger)
+		if err != nil {
+			t.Errorf("%s: %v", i.Name, err)
+			continue
+		}
+		if iface.Index == 0 || iface.Index != i.Index || iface.Name != i.Name {
+			t.Errorf("%s: got index %d, want %d", i.Name, iface.Index, i.Index)
+		}
+	}
+}
+
+func TestFilterPatterns(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	var ifaces []net.Interface
+	for _, name := range []string{"enp0s25", "ens3", "veth1a2b3c", "vethf00d", "docker0", "br-1234abcd", "eth0", "wlp2s0"} {
+		ifaces = append(ifaces, netInterface(name, up))
+	}
+	for _, tt := range []struct {
+		f    Filter
+		want []string
+	}{
+		{Filter{Exclude: []string{"veth*", "docker*", "br-*"}}, []string{"enp0s25", "ens3", "eth0", "wlp2s0"}},
+		{Filter{Include: []string{"en*"}, Exclude: []string{"ens?"}}, []string{"enp0s25"}},
+		{Filter{Include: []string{"eth0", "wl*"}}, []string{"eth0", "wlp2s0"}},
+		// Regular expressions match whole names.
+		{Filter{Regex: true, Include: []string{"en.*"}}, []string{"enp0s25", "ens3"}},
+		{Filter{Regex: true, Include: []string{"en"}}, nil},
+		{Filter{Regex: true, Exclude: []string{"(veth|docker|br-).*"}}, []string{"enp0s25", "ens3", "eth0", "wlp2s0"}},
+	} {
+		if err := tt.f.check(); err != nil {
+			t.Fatal(err)
+		}
+		if got := selected(tt.f, ifaces); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("include %q, exclude %q, regex %t: got %q, want %q", tt.f.Include, tt.f.Exclude, tt.f.Regex, got, tt.want)
+		}
+	}
+
+	for _, f := range []Filter{{Exclude: []string{"veth["}}, {Regex: true, Include: []string{"^(en"}}} {
+		if err := f.check(); err == nil {
+			t.Errorf("pattern %q: no error", append(f.Include, f.Exclude...))
+		}
+	}
+}
+
+func TestLinkTypeOf(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	for _, tt := range []struct {
+		i     net.Interface
+		iface Interface
+		want  string
+	}{
+		{netInterface("lan0", up), Interface{}, "ethernet"},
+		{netInterface("lan0.100", up), Interface{VLAN: VLAN{ID: 100, Parent: "lan0"}}, "vlan"},
+		{netInterface("testbr0", up), Interface{BridgeMembers: []string{}}, "bridge"},
+		{netInterface("testlo0", up|net.FlagLoopback), Interface{}, "loopback"},
+		{netInterface("testppp0", up|net.FlagPointToPoint), Interface{}, "point-to-point"},
+	} {
+		if got := linkTypeOf(tt.i, tt.iface); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.i.Name, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMinMTU(t *testing.T) {
+	up := net.FlagUp | net.FlagBroadcast
+	var ifaces []net.Interface
+	for name, mtu := range map[string]int{"lan0": 1500, "jumbo0": 9000, "wg0": 1420, "tiny0": 576} {
+		i := netInterface(name, up)
+		i.MTU = mtu
+		ifaces = append(ifaces, i)
+	}
+	for _, tt := range []struct {
+		min  int
+		want []string
+	}{
+		{0, []string{"jumbo0", "lan0", "tiny0", "wg0"}},
+		{1280, []string{"jumbo0", "lan0", "wg0"}},
+		{1500, []string{"jumbo0", "lan0"}},
+	} {
+		got := selected(Filter{MinMTU: tt.min}, ifaces)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MinMTU %d: got %q, want %q", tt.min, got, tt.want)
+		}
+	}
+
+	tiny := netInterface("tiny0", up)
+	tiny.MTU = 576
+	if reason := (Filter{MinMTU: 1280}).skipReason(tiny); reason != "MTU 576 is below 1280" {
+		t.Errorf("got skip reason %q", reason)
+	}
+	if err := (Filter{MinMTU: -1}).check(); err == nil {
+		t.Error("negative MinMTU: no error")
+	}
+}
+
+func TestAddresslessInterface(t *testing.T) {
+	// No interface has this index, so it has no addresses, but it has a MAC.
+	i := netInterface("testmac0", net.FlagUp|net.FlagBroadcast)
+	i.Index = 1 << 20
+	iface, err := describe(i, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iface.MAC != "02:00:00:00:00:01" || len(iface.Addrs) != 0 {
+		t.Fatalf("got MAC %q, addresses %q, want the MAC alone", iface.MAC, iface.Addrs)
+	}
+
+	// It is listed, saying why nothing is announced on it.
+	info := interfaceInfo(Filter{}, i, iface, nil, nil)
+	if info.Name != "testmac0" || info.Skip != skipNoAddrs {
+		t.Errorf("got %s skipped for %q, want %q", info.Name, info.Skip, skipNoAddrs)
+	}
+
+	// Planning passes over it without failing the others.
+	opts := testOptions(t, &fakeRunner{}, Options{})
+	anns, _, err := plan(opts, []Interface{threeInterfaces[0], iface}, threeRoutes[:1], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anns) != 1 || anns[0].iface.Name != "eth0" {
+		t.Errorf("got %d announcements, want eth0's alone", len(anns))
+	}
+}
@@ -0,0 +1,87 @@
+package arpingall
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// InterfaceInfo describes a local interface as arpingall sees it.
+type InterfaceInfo struct {
+	Interface
+	Up       bool
+	Type     string // ethernet, vlan, bridge, loopback, point-to-point or other
+	Gateway  net.IP // of its lowest-metric IPv4 default route, if any
+	Gateway6 net.IP // likewise for IPv6
+	Skip     string // why its addresses aren't announced, if they aren't
+}
+
+// ListInterfaces returns every local interface, whether opts.Filter selects
+// it or not, with its addresses and default gateways, for seeing what
+// arpingall would work with. Nothing is sent.
+func ListInterfaces(opts Options) ([]InterfaceInfo, error) {
+	if err := opts.Filter.check(); err != nil {
+		return nil, err
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	routes, routes6, err := loadRoutes(opts.Routes, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+	gateways := firstGateways(defaultGateways(filterTable(routes, opts.Table), opts.Logger))
+	gateways6 := firstGateways(defaultGateways(filterTable(routes6, opts.Table), opts.Logger))
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("getting interfaces: %w", err)
+	}
+	var infos []InterfaceInfo
+	for _, i := range ifaces {
+		iface, err := describe(i, opts.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("listing addresses of %s: %w", i.Name, err)
+		}
+		infos = append(infos, interfaceInfo(opts.Filter, i, iface, gateways[i.Name], gateways6[i.Name]))
+	}
+	return infos, nil
+}
+
+// interfaceInfo describes i, described as iface, with its default gateways,
+// saying why f leaves it out, if it does, or why it has nothing to announce.
+func interfaceInfo(f Filter, i net.Interface, iface Interface, gateway, gateway6 net.IP) InterfaceInfo {
+	info := InterfaceInfo{
+		Interface: iface,
+		Up:        i.Flags&net.FlagUp != 0,
+		Type:      linkTypeOf(i, iface),
+		Gateway:   gateway,
+		Gateway6:  gateway6,
+		Skip:      f.skipReason(i),
+	}
+	switch {
+	case info.Skip != "":
+	case iface.MAC == "":
+		info.Skip = "no MAC address"
+	case len(iface.Addrs) == 0:
+		info.Skip = skipNoAddrs
+	}
+	return info
+}
+
+// linkTypeOf names the kind of interface i is, described as iface.
+func linkTypeOf(i net.Interface, iface Interface) string {
+	switch {
+	case i.Flags&net.FlagLoopback != 0:
+		return "loopback"
+	case i.Flags&net.FlagPointToPoint != 0:
+		return "point-to-point"
+	case nonEthernet(i.Name):
+		return "other"
+	case iface.VLAN.ID != 0:
+		return "vlan"
+	case iface.BridgeMembers != nil:
+		return "bridge"
+	}
+	return "ethernet"
+}
@@ -0,0 +1,40 @@
+package arpingall
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// arphrdEther is the link type of Ethernet and of everything that looks like
+// it to ARP, such as bridges, bonds, VLANs and veths.
+const arphrdEther = 1
+
+// nonEthernet reports whether /sys/class/net/<name>/type says the interface
+// named name isn't Ethernet, e.g. because it is a tunnel. It reports false if
+// the type can't be read.
+func nonEthernet(name string) bool {
+	b, err := os.ReadFile(filepath.Join(sysClassNet, name, "type"))
+	if err != nil {
+		return false
+	}
+	t, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	return err == nil && t != arphrdEther
+}
+
+// hasZeroMAC reports whether i has an all-zero MAC address. Go reports an
+// empty HardwareAddr for one on Linux, so it is read from
+// /sys/class/net/<name>/address.
+func hasZeroMAC(i net.Interface) bool {
+	if zeroMAC(i.HardwareAddr) {
+		return true
+	}
+	b, err := os.ReadFile(filepath.Join(sysClassNet, i.Name, "address"))
+	if err != nil {
+		return false
+	}
+	mac, err := net.ParseMAC(strings.TrimSpace(string(b)))
+	return err == nil && zeroMAC(mac)
+}
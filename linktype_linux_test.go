@@ -0,0 +1,74 @@
+package arpingall
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNonEthernet(t *testing.T) {
+	defer func(dir string) { sysClassNet = dir }(sysClassNet)
+	sysClassNet = "testdata/sysfs"
+
+	for name, want := range map[string]bool{
+		"eth0":     false, // ARPHRD_ETHER
+		"br0":      false,
+		"tun0":     true, // ARPHRD_NONE
+		"ppp0":     true, // ARPHRD_PPP
+		"lo":       true, // ARPHRD_LOOPBACK
+		"garbled0": false,
+		"missing0": false,
+	} {
+		if got := nonEthernet(name); got != want {
+			t.Errorf("nonEthernet(%s) = %t, want %t", name, got, want)
+		}
+	}
+
+	tun0 := netInterface("tun0", net.FlagUp)
+	if reason := (Filter{}).skipReason(tun0); reason != "not an Ethernet interface" {
+		t.Errorf("tun0: got skip reason %q", reason)
+	}
+	if reason := (Filter{AllTypes: true}).skipReason(tun0); reason != "" {
+		t.Errorf("tun0 with AllTypes: got skip reason %q", reason)
+	}
+
+	// Loopback and point-to-point interfaces only need their own flag.
+	lo := netInterface("lo", net.FlagUp|net.FlagLoopback)
+	if reason := (Filter{IncludeLoopback: true}).skipReason(lo); reason != "" {
+		t.Errorf("lo with IncludeLoopback: got skip reason %q", reason)
+	}
+	ppp0 := netInterface("ppp0", net.FlagUp|net.FlagPointToPoint)
+	if reason := (Filter{IncludePointToPoint: true}).skipReason(ppp0); reason != "" {
+		t.Errorf("ppp0 with IncludePointToPoint: got skip reason %q", reason)
+	}
+	if reason := (Filter{IncludeLoopback: true}).skipReason(ppp0); reason != "not an Ethernet interface" {
+		t.Errorf("ppp0 with IncludeLoopback: got skip reason %q", reason)
+	}
+}
+
+func TestHasZeroMAC(t *testing.T) {
+	defer func(dir string) { sysClassNet = dir }(sysClassNet)
+	sysClassNet = "testdata/sysfs"
+
+	// Go gives an interface with an all-zero MAC no HardwareAddr at all.
+	dummy0 := netInterface("dummy0", net.FlagUp|net.FlagBroadcast)
+	dummy0.HardwareAddr = nil
+	for _, tt := range []struct {
+		iface net.Interface
+		want  bool
+	}{
+		{dummy0, true},
+		{netInterface("eth0", net.FlagUp), false},
+		{netInterface("missing0", net.FlagUp), false},
+	} {
+		if got := hasZeroMAC(tt.iface); got != tt.want {
+			t.Errorf("hasZeroMAC(%s) = %t, want %t", tt.iface.Name, got, tt.want)
+		}
+	}
+
+	if reason := (Filter{}).skipReason(dummy0); reason != "all-zero MAC address" {
+		t.Errorf("dummy0: got skip reason %q", reason)
+	}
+	if reason := (Filter{IncludeZeroMAC: true}).skipReason(dummy0); reason != "" {
+		t.Errorf("dummy0 with IncludeZeroMAC: got skip reason %q", reason)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package arpingall
+
+import "net"
+
+// nonEthernet reports whether the interface named name isn't Ethernet. Link
+// types are only read on Linux.
+func nonEthernet(name string) bool {
+	return false
+}
+
+// hasZeroMAC reports whether i has an all-zero MAC address.
+func hasZeroMAC(i net.Interface) bool {
+	return zeroMAC(i.HardwareAddr)
+}
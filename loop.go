@@ -0,0 +1,30 @@
+package arpingall
+
+import (
+	"context"
+	"time"
+)
+
+// Loop announces once and then again every interval, until ctx is done. The
+// results of each run are passed to report. Unlike Watch, it runs on a timer
+// whether or not anything changed. Runs never overlap: one that takes longer
+// than interval delays the next.
+func Loop(ctx context.Context, opts Options, interval time.Duration, report func(Results, error)) {
+	run := func(ctx context.Context) (Results, error) { return AnnounceAllContext(ctx, opts) }
+	loop(ctx, interval, run, report)
+}
+
+// loop is Loop with each run made by run.
+func loop(ctx context.Context, interval time.Duration, run func(context.Context) (Results, error), report func(Results, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report(run(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLoop(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs, reports := 0, 0
+	run := func(context.Context) (Results, error) {
+		runs++
+		if runs == 3 {
+			cancel() // stopped during the third run
+		}
+		return Results{{Interface: "eth0"}}, nil
+	}
+	report := func(results Results, err error) {
+		reports++
+		if len(results) != 1 || err != nil {
+			t.Errorf("run %d: got %d results, %v", reports, len(results), err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		loop(ctx, time.Millisecond, run, report)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop didn't return after cancel")
+	}
+	if runs != 3 || reports != 3 {
+		t.Errorf("got %d runs and %d reports, want 3 of each", runs, reports)
+	}
+
+	// The ticker and its goroutines are gone.
+	for i := 0; runtime.NumGoroutine() > before && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines after the loop, %d before", n, before)
+	}
+}
+
+func TestLoopReportsErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	failure := errors.New("getting interfaces: permission denied")
+	var got []error
+	loop(ctx, time.Millisecond, func(context.Context) (Results, error) {
+		if len(got) == 1 {
+			cancel()
+			return nil, nil
+		}
+		return nil, failure
+	}, func(_ Results, err error) { got = append(got, err) })
+
+	// A failed run doesn't stop the loop.
+	if len(got) != 2 || got[0] != failure || got[1] != nil {
+		t.Errorf("got reports %v, want the error and then success", got)
+	}
+}
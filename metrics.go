@@ -0,0 +1,140 @@
+package arpingall
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the announce duration
+// histogram. They match the Prometheus client's defaults.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects announcement metrics across runs. It is an http.Handler
+// serving them in the Prometheus text exposition format:
+//
+//	arpingall_announcements_total{interface,result}  counter
+//	arpingall_announce_duration_seconds{interface}   histogram
+//	arpingall_last_run_timestamp                     gauge
+type Metrics struct {
+	mu            sync.Mutex
+	announcements map[[2]string]uint64 // by interface and result
+	durations     map[string]*histogram
+	lastRun       time.Time
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		announcements: make(map[[2]string]uint64),
+		durations:     make(map[string]*histogram),
+	}
+}
+
+// Observe records the results of a run.
+func (m *Metrics) Observe(results Results) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range results {
+		if r.Skipped != "" {
+			continue
+		}
+		result := "success"
+		if r.Err != nil {
+			result = "failure"
+		}
+		m.announcements[[2]string{r.Interface, result}]++
+
+		h := m.durations[r.Interface]
+		if h == nil {
+			h = &histogram{counts: make([]uint64, len(durationBuckets))}
+			m.durations[r.Interface] = h
+		}
+		seconds := r.Duration.Seconds()
+		for i, le := range durationBuckets {
+			if seconds <= le {
+				h.counts[i]++
+				break
+			}
+		}
+		h.sum += seconds
+		h.count++
+	}
+	m.lastRun = time.Now()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP arpingall_announcements_total Announcements sent, by interface and result.\n")
+	b.WriteString("# TYPE arpingall_announcements_total counter\n")
+	keys := make([][2]string, 0, len(m.announcements))
+	for k := range m.announcements {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "arpingall_announcements_total{interface=%s,result=%s} %d\n", quoteLabel(k[0]), quoteLabel(k[1]), m.announcements[k])
+	}
+
+	b.WriteString("# HELP arpingall_announce_duration_seconds Time taken by each announcement.\n")
+	b.WriteString("# TYPE arpingall_announce_duration_seconds histogram\n")
+	names := make([]string, 0, len(m.durations))
+	for name := range m.durations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := m.durations[name]
+		label := quoteLabel(name)
+		cumulative := uint64(0)
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "arpingall_announce_duration_seconds_bucket{interface=%s,le=\"%g\"} %d\n", label, le, cumulative)
+		}
+		fmt.Fprintf(&b, "arpingall_announce_duration_seconds_bucket{interface=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "arpingall_announce_duration_seconds_sum{interface=%s} %g\n", label, h.sum)
+		fmt.Fprintf(&b, "arpingall_announce_duration_seconds_count{interface=%s} %d\n", label, h.count)
+	}
+
+	b.WriteString("# HELP arpingall_last_run_timestamp Unix time of the last completed run.\n")
+	b.WriteString("# TYPE arpingall_last_run_timestamp gauge\n")
+	lastRun := 0.0
+	if !m.lastRun.IsZero() {
+		lastRun = float64(m.lastRun.UnixNano()) / 1e9
+	}
+	fmt.Fprintf(&b, "arpingall_last_run_timestamp %g\n", lastRun)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// quoteLabel quotes a label value, escaping it as Prometheus requires.
+func quoteLabel(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
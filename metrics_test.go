@@ -0,0 +1,44 @@
+package arpingall
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	opts := testOptions(t, &fakeRunner{run: failOn("eth1")}, Options{})
+	results, err := announceAll(context.Background(), opts, planning(opts, threeInterfaces, threeRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics()
+	m.Observe(results)
+	m.Observe(results[:1])
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		"# TYPE arpingall_announcements_total counter",
+		`arpingall_announcements_total{interface="eth0",result="success"} 2`,
+		`arpingall_announcements_total{interface="eth1",result="failure"} 1`,
+		`arpingall_announcements_total{interface="eth2",result="success"} 1`,
+		"# TYPE arpingall_announce_duration_seconds histogram",
+		`arpingall_announce_duration_seconds_bucket{interface="eth0",le="+Inf"} 2`,
+		`arpingall_announce_duration_seconds_count{interface="eth1"} 1`,
+		"# TYPE arpingall_last_run_timestamp gauge",
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("no %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "arpingall_last_run_timestamp 0\n") {
+		t.Error("last run timestamp not set")
+	}
+}
@@ -0,0 +1,98 @@
+package arpingall
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// sendNative sends count gratuitous ARPs with operation op for a, directly
+// on an AF_PACKET raw socket, one second apart like arping does. They are
+// sent from srcMAC, or the interface's own MAC if it is nil, to a.targetMAC,
+// or broadcast if it is nil. For a VLAN sub-interface the frame is tagged
+// with its VLAN id and sent on the parent. Opening the socket needs
+// CAP_NET_RAW.
+func sendNative(ctx context.Context, a announcement, op uint16, count int, srcMAC net.HardwareAddr) error {
+	index, name, mac := a.iface.Index, a.iface.Name, a.iface.MAC
+	if index == 0 {
+		// Not from Interfaces; look it up.
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return err
+		}
+		index, mac = ifi.Index, ifi.HardwareAddr.String()
+	}
+	if srcMAC == nil {
+		var err error
+		if srcMAC, err = net.ParseMAC(mac); err != nil {
+			return fmt.Errorf("MAC address of %s: %w", name, err)
+		}
+	}
+	frame := arpFrame(op, srcMAC, a.targetMAC, a.source, a.gateway)
+	if vlan := a.iface.VLAN; vlan.ID != 0 {
+		ifi, err := net.InterfaceByName(vlan.Parent)
+		if err != nil {
+			return fmt.Errorf("VLAN %d parent: %w", vlan.ID, err)
+		}
+		index, name = ifi.Index, ifi.Name
+		frame = vlanTag(frame, vlan.ID)
+	}
+	if a.via != "" {
+		// Out of the bridge member, still from the bridge's MAC.
+		ifi, err := net.InterfaceByName(a.via)
+		if err != nil {
+			return fmt.Errorf("bridge member: %w", err)
+		}
+		index, name = ifi.Index, ifi.Name
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ARP)))
+	if err != nil {
+		return fmt.Errorf("open raw socket: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	addr := linkLayerAddr(index, a.targetMAC)
+
+	for n := 0; n < count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		if err := syscall.Sendto(fd, frame, 0, addr); err != nil {
+			if err == syscall.ENETDOWN {
+				return fmt.Errorf("send ARP on %s: %w: %w", name, ErrInterfaceDown, err)
+			}
+			return fmt.Errorf("send ARP on %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// linkLayerAddr returns the address to send ARP frames to dst, or the
+// broadcast MAC if it is nil, out of the interface with the given index. A
+// packet socket sends there whatever the routes say, which is what
+// announcing per interface needs.
+func linkLayerAddr(index int, dst net.HardwareAddr) *syscall.SockaddrLinklayer {
+	if dst == nil {
+		dst = broadcastMAC
+	}
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ARP),
+		Ifindex:  index,
+		Halen:    uint8(len(dst)),
+	}
+	copy(addr.Addr[:], dst)
+	return addr
+}
+
+// htons converts v to network byte order.
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
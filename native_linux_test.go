@@ -0,0 +1,26 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestLinkLayerAddr(t *testing.T) {
+	addr := linkLayerAddr(7, nil)
+	if addr.Ifindex != 7 || addr.Halen != 6 || net.HardwareAddr(addr.Addr[:6]).String() != broadcastMAC.String() {
+		t.Errorf("got index %d, address %x (length %d); want 7 and the broadcast MAC", addr.Ifindex, addr.Addr, addr.Halen)
+	}
+	// The protocol is ETH_P_ARP in network byte order, as stored in memory.
+	var proto [2]byte
+	binary.NativeEndian.PutUint16(proto[:], addr.Protocol)
+	if binary.BigEndian.Uint16(proto[:]) != syscall.ETH_P_ARP {
+		t.Errorf("got protocol %#04x, want ETH_P_ARP in network byte order", addr.Protocol)
+	}
+
+	gw := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x01, 0x01}
+	if addr := linkLayerAddr(7, gw); net.HardwareAddr(addr.Addr[:addr.Halen]).String() != gw.String() {
+		t.Errorf("got address %x, want %s", addr.Addr[:addr.Halen], gw)
+	}
+}
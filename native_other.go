@@ -0,0 +1,13 @@
+//go:build !linux
+
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+func sendNative(ctx context.Context, a announcement, op uint16, count int, srcMAC net.HardwareAddr) error {
+	return errors.New("native ARP sending is only supported on Linux")
+}
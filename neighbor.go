@@ -0,0 +1,70 @@
+package arpingall
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// neighborFile is where the kernel lists its ARP cache, which tests replace.
+var neighborFile = "/proc/net/arp"
+
+// Flags of an entry in the Flags column of /proc/net/arp.
+const (
+	atfCom  = 0x02 // complete
+	atfPerm = 0x04 // permanent
+)
+
+// Neighbor is an entry in the kernel's IPv4 neighbor (ARP) cache.
+type Neighbor struct {
+	IP        net.IP
+	MAC       string
+	Interface string
+	Flags     int
+}
+
+// GetNeighbors reads the ARP cache from /proc/net/arp.
+func GetNeighbors() ([]Neighbor, error) {
+	file, err := os.Open(neighborFile)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", neighborFile, err)
+	}
+	defer file.Close()
+	return parseNeighbors(file)
+}
+
+// parseNeighbors parses the /proc/net/arp format, skipping the header and
+// incomplete entries:
+//
+//	IP address    HW type  Flags  HW address         Mask  Device
+//	192.0.2.1     0x1      0x2    02:00:00:00:00:01  *     eth0
+func parseNeighbors(r io.Reader) ([]Neighbor, error) {
+	var neighbors []Neighbor
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if lineNum == 1 || len(fields) == 0 {
+			continue // header or blank
+		}
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("wrong number of fields (expected 6, got %d): %s", len(fields), scanner.Text())
+		}
+		ip := net.ParseIP(fields[0]).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid neighbor address %q", fields[0])
+		}
+		flags, err := strconv.ParseInt(fields[2], 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags %q: %w", fields[2], err)
+		}
+		if flags&atfCom == 0 {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{IP: ip, MAC: fields[3], Interface: fields[5], Flags: int(flags)})
+	}
+	return neighbors, scanner.Err()
+}
@@ -0,0 +1,81 @@
+package arpingall
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const arpCache = `IP address       HW type     Flags       HW address            Mask     Device
+192.0.2.1        0x1         0x2         02:00:00:00:00:01     *        eth0
+192.0.2.20       0x1         0x0         00:00:00:00:00:00     *        eth0
+192.0.2.30       0x1         0x6         02:00:00:00:00:1e     *        eth0
+
+198.51.100.1     0x1         0x2         02:00:00:00:01:01     *        eth1
+`
+
+func TestParseNeighbors(t *testing.T) {
+	neighbors, err := parseNeighbors(strings.NewReader(arpCache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range neighbors {
+		got = append(got, fmt.Sprintf("%s %s %s %#x", n.Interface, n.IP, n.MAC, n.Flags))
+	}
+	// The incomplete entry, without ATF_COM, is skipped.
+	want := []string{
+		"eth0 192.0.2.1 02:00:00:00:00:01 0x2",
+		"eth0 192.0.2.30 02:00:00:00:00:1e 0x6",
+		"eth1 198.51.100.1 02:00:00:00:01:01 0x2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseNeighborsErrors(t *testing.T) {
+	header := "IP address       HW type     Flags       HW address            Mask     Device\n"
+	for _, tt := range []struct {
+		line string
+		want string
+	}{
+		{"192.0.2.1 0x1 0x2 02:00:00:00:00:01 *", "wrong number of fields"},
+		{"2001:db8::1 0x1 0x2 02:00:00:00:00:01 * eth0", "invalid neighbor address"},
+		{"192.0.2.1 0x1 complete 02:00:00:00:00:01 * eth0", "invalid flags"},
+	} {
+		_, err := parseNeighbors(strings.NewReader(header + tt.line + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseNeighbors(%q) = %v, want an error containing %q", tt.line, err, tt.want)
+		}
+	}
+}
+
+func TestPlanRefreshNeighbors(t *testing.T) {
+	neighbors, err := parseNeighbors(strings.NewReader(arpCache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24")}
+	routes4, routes6 := splitFamilies([]Route{defaultRoute("eth0", "192.0.2.1", 0)})
+
+	// The gateway isn't announced to twice, and eth1's neighbor isn't on
+	// eth0.
+	for _, tt := range []struct {
+		refresh bool
+		want    []string
+	}{
+		{false, []string{"eth0 192.0.2.10>192.0.2.1"}},
+		{true, []string{"eth0 192.0.2.10>192.0.2.1", "eth0 192.0.2.10>192.0.2.30"}},
+	} {
+		opts := testOptions(t, nil, Options{RefreshNeighbors: tt.refresh})
+		anns, _, err := plan(opts, ifaces, routes4, routes6, neighbors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := announced(anns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RefreshNeighbors %t: got %q, want %q", tt.refresh, got, tt.want)
+		}
+	}
+}
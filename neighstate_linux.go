@@ -0,0 +1,128 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+)
+
+// Neighbor states (NUD_*), as ip neigh shows them.
+var nudStates = []struct {
+	bit  uint16
+	name string
+}{
+	{0x01, "INCOMPLETE"},
+	{0x02, "REACHABLE"},
+	{0x04, "STALE"},
+	{0x08, "DELAY"},
+	{0x10, "PROBE"},
+	{0x20, "FAILED"},
+	{0x40, "NOARP"},
+	{0x80, "PERMANENT"},
+}
+
+// struct ndmsg and the NDA_DST attribute, missing from syscall.
+const (
+	sizeofNdMsg = 12
+	ndaDst      = 1
+)
+
+// neighborState dumps the kernel's neighbor tables over netlink
+// (RTM_GETNEIGH) and returns the state of ip on the interface with the given
+// index and name, such as REACHABLE or STALE, or NONE if it isn't there. If
+// netlink fails, the state of an IPv4 address is read from /proc/net/arp
+// instead, which only tells PERMANENT and COMPLETE entries apart.
+func neighborState(index int, name string, ip net.IP, logger *slog.Logger) (string, error) {
+	state, err := neighborStateNetlink(index, ip)
+	if err == nil || ip.To4() == nil {
+		return state, err
+	}
+	logger.Debug("Can't dump neighbors over netlink; falling back to procfs", "err", err)
+	neighbors, err := GetNeighbors()
+	if err != nil {
+		return "", err
+	}
+	return arpCacheState(neighbors, name, ip), nil
+}
+
+// neighborStateNetlink is neighborState over netlink only.
+func neighborStateNetlink(index int, ip net.IP) (string, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		return "", fmt.Errorf("netlink neighbor dump: %w", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return "", fmt.Errorf("parse netlink neighbor dump: %w", err)
+	}
+	return stateIn(msgs, index, ip), nil
+}
+
+// arpCacheState returns the state of ip on the interface named name in the
+// complete ARP cache entries neighbors: PERMANENT, COMPLETE for any other
+// (REACHABLE, STALE and so on look alike there), or NONE if it isn't there.
+func arpCacheState(neighbors []Neighbor, name string, ip net.IP) string {
+	for _, n := range neighbors {
+		if n.Interface != name || !n.IP.Equal(ip) {
+			continue
+		}
+		if n.Flags&atfPerm != 0 {
+			return "PERMANENT"
+		}
+		return "COMPLETE"
+	}
+	return "NONE"
+}
+
+// stateIn returns the state of ip on the interface with the given index in
+// the neighbor dump msgs, or NONE if it isn't there.
+func stateIn(msgs []syscall.NetlinkMessage, index int, ip net.IP) string {
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < sizeofNdMsg {
+			continue
+		}
+		// struct ndmsg: family, pad (3 bytes), ifindex, state, flags, type
+		ifindex := int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+		state := binary.NativeEndian.Uint16(m.Data[8:10])
+		if ifindex != index {
+			continue
+		}
+		if dst := neighborAttr(m.Data[sizeofNdMsg:], ndaDst); dst != nil && net.IP(dst).Equal(ip) {
+			return nudName(state)
+		}
+	}
+	return "NONE"
+}
+
+// neighborAttr returns the value of the route attribute of type typ in b,
+// or nil. syscall.ParseNetlinkRouteAttr doesn't handle neighbor messages.
+func neighborAttr(b []byte, typ uint16) []byte {
+	for len(b) >= syscall.SizeofRtAttr {
+		l := int(binary.NativeEndian.Uint16(b[0:2]))
+		t := binary.NativeEndian.Uint16(b[2:4])
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			return nil
+		}
+		if t == typ {
+			return b[syscall.SizeofRtAttr:l]
+		}
+		next := (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if next > len(b) {
+			return nil
+		}
+		b = b[next:]
+	}
+	return nil
+}
+
+// nudName names the neighbor state state.
+func nudName(state uint16) string {
+	for _, s := range nudStates {
+		if state&s.bit != 0 {
+			return s.name
+		}
+	}
+	return "NONE"
+}
@@ -0,0 +1,80 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// neighMessage returns an RTM_NEWNEIGH message for ip on the interface with
+// the given index, in the given NUD_* state.
+func neighMessage(index int, state uint16, ip net.IP) syscall.NetlinkMessage {
+	family := byte(syscall.AF_INET6)
+	if ip.To4() != nil {
+		family, ip = syscall.AF_INET, ip.To4()
+	}
+	data := []byte{family, 0, 0, 0}
+	data = binary.NativeEndian.AppendUint32(data, uint32(index))
+	data = binary.NativeEndian.AppendUint16(data, state)
+	data = append(data, 0, 0) // flags, type
+	data = binary.NativeEndian.AppendUint16(data, uint16(syscall.SizeofRtAttr+len(ip)))
+	data = binary.NativeEndian.AppendUint16(data, ndaDst)
+	data = append(data, ip...)
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWNEIGH}, Data: data}
+}
+
+func TestStateIn(t *testing.T) {
+	msgs := []syscall.NetlinkMessage{
+		neighMessage(2, 0x02, net.ParseIP("192.0.2.1")),
+		neighMessage(2, 0x04, net.ParseIP("192.0.2.30")),
+		neighMessage(3, 0x20, net.ParseIP("198.51.100.1")),
+		neighMessage(2, 0x04, net.ParseIP("fe80::1")),
+		// The same address on another interface is another neighbor.
+		neighMessage(4, 0x80, net.ParseIP("192.0.2.1")),
+		{Header: syscall.NlMsghdr{Type: syscall.NLMSG_DONE}},
+	}
+	for _, tt := range []struct {
+		index int
+		ip    string
+		want  string
+	}{
+		{2, "192.0.2.1", "REACHABLE"},
+		{2, "192.0.2.30", "STALE"},
+		{3, "198.51.100.1", "FAILED"},
+		{2, "fe80::1", "STALE"},
+		{4, "192.0.2.1", "PERMANENT"},
+		{3, "192.0.2.1", "NONE"},
+		{2, "192.0.2.99", "NONE"},
+	} {
+		if got := stateIn(msgs, tt.index, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("%s on index %d: got %s, want %s", tt.ip, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestARPCacheState(t *testing.T) {
+	defer func(path string) { neighborFile = path }(neighborFile)
+	neighborFile = "testdata/arp.txt"
+
+	neighbors, err := GetNeighbors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		iface string
+		ip    string
+		want  string
+	}{
+		{"eth0", "192.0.2.1", "COMPLETE"},
+		{"eth0", "192.0.2.30", "PERMANENT"},
+		{"eth0", "192.0.2.20", "NONE"}, // incomplete
+		{"eth2", "192.0.2.1", "COMPLETE"},
+		{"eth1", "192.0.2.1", "NONE"},
+		{"eth0", "192.0.2.99", "NONE"},
+	} {
+		if got := arpCacheState(neighbors, tt.iface, net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("%s on %s: got %s, want %s", tt.ip, tt.iface, got, tt.want)
+		}
+	}
+}
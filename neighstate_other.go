@@ -0,0 +1,13 @@
+//go:build !linux
+
+package arpingall
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+)
+
+func neighborState(index int, name string, ip net.IP, logger *slog.Logger) (string, error) {
+	return "", errors.New("reading neighbor states is only supported on Linux")
+}
@@ -0,0 +1,122 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// rtaVia is the RTA_VIA route attribute, missing from syscall: a gateway of
+// another family than the route, as an IPv4 route via an IPv6 next hop.
+const rtaVia = 18
+
+// GetRoutesNetlink dumps the kernel's IPv4 and IPv6 routing tables over
+// netlink (RTM_GETROUTE). Unlike /proc/net/route it covers both families and
+// all tables, so policy routing is seen, and it reports the output interface
+// index, which is resolved to a name.
+func GetRoutesNetlink() ([]Route, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("netlink route dump: %w", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, fmt.Errorf("parse netlink route dump: %w", err)
+	}
+
+	names := make(map[int]string)
+	routes := []Route{}
+	for i := range msgs {
+		route, ok, err := parseRouteMessage(&msgs[i])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if route.Index != 0 {
+			name, found := names[route.Index]
+			if !found {
+				if ifi, err := net.InterfaceByIndex(route.Index); err == nil {
+					name = ifi.Name
+				}
+				names[route.Index] = name
+			}
+			route.Interface = name
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// parseRouteMessage decodes an RTM_NEWROUTE message (struct rtmsg followed by
+// route attributes). It reports false for other messages and for routes that
+// aren't unicast routes.
+func parseRouteMessage(m *syscall.NetlinkMessage) (Route, bool, error) {
+	var route Route
+	if m.Header.Type != syscall.RTM_NEWROUTE {
+		return route, false, nil
+	}
+	if len(m.Data) < syscall.SizeofRtMsg {
+		return route, false, fmt.Errorf("short rtmsg (%d bytes)", len(m.Data))
+	}
+
+	// struct rtmsg: family, dst_len, src_len, tos, table, protocol, scope,
+	// type, flags
+	family, dstLen, table, typ := m.Data[0], int(m.Data[1]), m.Data[4], m.Data[7]
+	if typ != syscall.RTN_UNICAST {
+		return route, false, nil
+	}
+	// rtm_table only holds ids below 256; RTA_TABLE, if present, has the
+	// full id.
+	route.Table = int(table)
+
+	bits := 8 * net.IPv4len
+	switch family {
+	case syscall.AF_INET:
+	case syscall.AF_INET6:
+		bits = 8 * net.IPv6len
+	default:
+		return route, false, nil
+	}
+	route.Destination = make(net.IP, bits/8)
+	route.Gateway = make(net.IP, bits/8)
+	route.Mask = net.CIDRMask(dstLen, bits)
+	route.Flags = RTF_UP
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return route, false, fmt.Errorf("parse route attributes: %w", err)
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_DST:
+			route.Destination = net.IP(a.Value)
+		case syscall.RTA_GATEWAY:
+			route.Gateway = net.IP(a.Value)
+			route.Flags |= RTF_GATEWAY
+		case rtaVia:
+			// struct rtvia: family (2 bytes), address
+			if len(a.Value) > 2 {
+				route.Gateway = net.IP(a.Value[2:])
+				route.Flags |= RTF_GATEWAY
+			}
+		case syscall.RTA_OIF:
+			if len(a.Value) >= 4 {
+				route.Index = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		case syscall.RTA_PREFSRC:
+			route.PrefSrc = net.IP(a.Value)
+		case syscall.RTA_TABLE:
+			if len(a.Value) >= 4 {
+				route.Table = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		case syscall.RTA_PRIORITY:
+			if len(a.Value) >= 4 {
+				route.Metric = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		}
+	}
+	return route, true, nil
+}
@@ -0,0 +1,61 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// rtAttr is a route attribute for routeMessage.
+type rtAttr struct {
+	typ   int
+	value []byte
+}
+
+// routeMessage returns an RTM_NEWROUTE message for a unicast route in the
+// main table with the given family, destination prefix length and
+// attributes.
+func routeMessage(family byte, dstLen int, attrs ...rtAttr) *syscall.NetlinkMessage {
+	data := []byte{family, byte(dstLen), 0, 0, syscall.RT_TABLE_MAIN, syscall.RTPROT_BOOT, syscall.RT_SCOPE_UNIVERSE, syscall.RTN_UNICAST, 0, 0, 0, 0}
+	for _, a := range attrs {
+		data = binary.NativeEndian.AppendUint16(data, uint16(syscall.SizeofRtAttr+len(a.value)))
+		data = binary.NativeEndian.AppendUint16(data, uint16(a.typ))
+		data = append(data, a.value...)
+		for len(data)%syscall.RTA_ALIGNTO != 0 {
+			data = append(data, 0)
+		}
+	}
+	return &syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWROUTE}, Data: data}
+}
+
+func TestParseRouteMessagePrefSrc(t *testing.T) {
+	gateway := rtAttr{syscall.RTA_GATEWAY, net.ParseIP("192.0.2.1").To4()}
+	m := routeMessage(syscall.AF_INET, 0, gateway, rtAttr{syscall.RTA_PREFSRC, net.ParseIP("192.0.2.20").To4()})
+	route, ok, err := parseRouteMessage(m)
+	if err != nil || !ok {
+		t.Fatalf("parseRouteMessage: %t, %v", ok, err)
+	}
+	if !route.PrefSrc.Equal(net.ParseIP("192.0.2.20")) || !route.Gateway.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("got gateway %s, prefsrc %s", route.Gateway, route.PrefSrc)
+	}
+
+	// Without the attribute there is no preferred source.
+	route, _, _ = parseRouteMessage(routeMessage(syscall.AF_INET, 0, gateway))
+	if route.PrefSrc != nil {
+		t.Errorf("got prefsrc %s without RTA_PREFSRC", route.PrefSrc)
+	}
+}
+
+func TestParseRouteMessageLinkLocalGateway(t *testing.T) {
+	oif := binary.NativeEndian.AppendUint32(nil, 2)
+	m := routeMessage(syscall.AF_INET6, 0, rtAttr{syscall.RTA_GATEWAY, net.ParseIP("fe80::1")}, rtAttr{syscall.RTA_OIF, oif})
+	route, ok, err := parseRouteMessage(m)
+	if err != nil || !ok {
+		t.Fatalf("parseRouteMessage: %t, %v", ok, err)
+	}
+	// The gateway is only meaningful on the route's interface.
+	if !route.Gateway.Equal(net.ParseIP("fe80::1")) || route.Index != 2 || !isDefaultGateway(route) {
+		t.Errorf("got gateway %s on index %d, flags %#x", route.Gateway, route.Index, route.Flags)
+	}
+}
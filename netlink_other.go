@@ -0,0 +1,10 @@
+//go:build !linux
+
+package arpingall
+
+import "errors"
+
+// GetRoutesNetlink is only supported on Linux.
+func GetRoutesNetlink() ([]Route, error) {
+	return nil, errors.New("netlink is only supported on Linux")
+}
@@ -0,0 +1,136 @@
+package arpingall
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// GetRoutesNetstat reads the IPv4 and IPv6 routing tables from netstat -rn,
+// for platforms without /proc/net/route. Only default routes and
+// destinations in CIDR notation are returned.
+func GetRoutesNetstat() ([]Route, error) {
+	output, err := exec.Command("netstat", "-rn").Output()
+	if err != nil {
+		return nil, fmt.Errorf("netstat -rn: %w", err)
+	}
+	return parseNetstat(bytes.NewReader(output))
+}
+
+// parseNetstat parses netstat -rn output as printed by macOS and the BSDs:
+//
+//	Internet:
+//	Destination        Gateway            Flags     Netif Expire
+//	default            192.0.2.1          UGScg       en0
+//
+// Columns are located by their header, which differs between systems.
+func parseNetstat(r io.Reader) ([]Route, error) {
+	routes := []Route{}
+
+	var columns map[string]int
+	bits := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "Internet:":
+			bits, columns = 8*net.IPv4len, nil
+			continue
+		case fields[0] == "Internet6:":
+			bits, columns = 8*net.IPv6len, nil
+			continue
+		case fields[0] == "Destination":
+			columns = make(map[string]int)
+			for i, f := range fields {
+				columns[f] = i
+			}
+			continue
+		case bits == 0 || columns == nil:
+			continue // not in a table we understand
+		}
+
+		route, ok := parseNetstatRoute(fields, columns, bits)
+		if ok {
+			routes = append(routes, route)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// interfaceColumns are the names netstat -rn gives the interface column:
+// Netif on macOS, FreeBSD and DragonFly, Iface on OpenBSD and Interface on
+// NetBSD.
+var interfaceColumns = []string{"Netif", "Iface", "Interface"}
+
+// parseNetstatRoute converts one netstat -rn row to a Route. It reports false
+// for rows it can't represent.
+func parseNetstatRoute(fields []string, columns map[string]int, bits int) (Route, bool) {
+	column := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	var route Route
+	for _, name := range interfaceColumns {
+		if route.Interface = column(name); route.Interface != "" {
+			break
+		}
+	}
+	if route.Interface == "" {
+		return route, false
+	}
+
+	dst := column("Destination")
+	if dst == "default" {
+		route.Destination = make(net.IP, bits/8)
+		route.Mask = net.CIDRMask(0, bits)
+	} else {
+		_, ipnet, err := net.ParseCIDR(stripZone(dst))
+		if err != nil {
+			return route, false
+		}
+		route.Destination, route.Mask = ipnet.IP, ipnet.Mask
+	}
+
+	// Gateways of on-link routes are shown as link#N or a MAC address.
+	route.Gateway = net.ParseIP(stripZone(column("Gateway")))
+	if route.Gateway == nil {
+		route.Gateway = make(net.IP, bits/8)
+	} else if bits == 8*net.IPv4len {
+		route.Gateway = route.Gateway.To4()
+	}
+
+	flags := column("Flags")
+	if strings.Contains(flags, "U") {
+		route.Flags |= RTF_UP
+	}
+	if strings.Contains(flags, "G") {
+		route.Flags |= RTF_GATEWAY
+	}
+	if strings.ContainsAny(flags, "RB") {
+		route.Flags |= RTF_REJECT // reject or blackhole
+	}
+	return route, true
+}
+
+// stripZone removes an IPv6 zone such as %en0 from s.
+func stripZone(s string) string {
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		if j := strings.IndexByte(s[i:], '/'); j >= 0 {
+			return s[:i] + s[i+j:]
+		}
+		return s[:i]
+	}
+	return s
+}
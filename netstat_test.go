@@ -0,0 +1,64 @@
+package arpingall
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestParseNetstat(t *testing.T) {
+	tests := []struct {
+		file      string
+		gateways  map[string]string
+		gateways6 map[string]string
+	}{
+		{"testdata/netstat-darwin.txt", map[string]string{"en0": "192.168.1.1"}, map[string]string{"en0": "fe80::1"}},
+		{"testdata/netstat-freebsd.txt", map[string]string{"em0": "192.168.1.1"}, map[string]string{"em0": "2001:db8::1"}},
+		{"testdata/netstat-openbsd.txt", map[string]string{"em0": "192.168.1.1"}, map[string]string{"em0": "2001:db8::1"}},
+		{"testdata/netstat-netbsd.txt", map[string]string{"wm0": "192.168.1.1"}, map[string]string{"wm0": "2001:db8::1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file, err := os.Open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			all, err := parseNetstat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			routes, routes6 := splitFamilies(all)
+			checkGateways(t, "IPv4", firstGateways(defaultGateways(routes, discardLogger)), tt.gateways)
+			checkGateways(t, "IPv6", firstGateways(defaultGateways(routes6, discardLogger)), tt.gateways6)
+		})
+	}
+}
+
+func TestParseNetstatRouteFlags(t *testing.T) {
+	columns := map[string]int{"Destination": 0, "Gateway": 1, "Flags": 2, "Netif": 3}
+	r, ok := parseNetstatRoute([]string{"192.0.2.0/24", "link#1", "U", "en0"}, columns, 32)
+	if !ok {
+		t.Fatal("on-link route not parsed")
+	}
+	if r.Flags != RTF_UP || !r.Gateway.Equal(net.IPv4zero) {
+		t.Errorf("on-link route: flags %#x, gateway %s; want RTF_UP and 0.0.0.0", r.Flags, r.Gateway)
+	}
+	if _, ok := parseNetstatRoute([]string{"default", "192.0.2.1", "UGS"}, columns, 32); ok {
+		t.Error("route without an interface parsed")
+	}
+}
+
+// checkGateways compares the gateway of each interface in got to want.
+func checkGateways(t *testing.T, family string, got map[string]net.IP, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s default gateways: got %v, want %v", family, got, want)
+		return
+	}
+	for name, gw := range want {
+		if !got[name].Equal(net.ParseIP(gw)) {
+			t.Errorf("%s default gateway of %s: got %s, want %s", family, name, got[name], gw)
+		}
+	}
+}
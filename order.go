@@ -0,0 +1,28 @@
+package arpingall
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// newRand returns the random source of Options.RandomizeOrder and
+// Options.Jitter: seeded with seed or, if it is zero, with the hostname and
+// the time, so that hosts started at the same moment still differ.
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		h := fnv.New64a()
+		hostname, _ := os.Hostname()
+		h.Write([]byte(hostname))
+		seed = int64(h.Sum64()) ^ time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// shuffled returns a copy of anns in random order.
+func shuffled(anns []announcement, rng *rand.Rand) []announcement {
+	out := append([]announcement(nil), anns...)
+	rng.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
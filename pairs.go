@@ -0,0 +1,172 @@
+package arpingall
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// Pair is an announcement given explicitly rather than discovered: Source is
+// announced on Interface to Gateway.
+type Pair struct {
+	Interface string
+	Source    net.IP
+	Gateway   net.IP
+}
+
+// AnnouncePairs announces each of pairs as given, without discovering
+// interfaces or routes. It is otherwise like AnnounceAllContext. A pair whose
+// interface doesn't exist, or whose source isn't assigned to it, fails.
+func AnnouncePairs(ctx context.Context, opts Options, pairs []Pair) (Results, error) {
+	opts, err := prepare(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts = withVariant(ctx, opts)
+
+	var anns []announcement
+	var invalid Results
+	for _, p := range pairs {
+		a, err := pairAnnouncement(opts, p)
+		if err != nil {
+			r := Result{Interface: p.Interface, SourceIP: p.Source, Gateway: p.Gateway, Err: err}
+			notify(opts, r)
+			invalid = append(invalid, r)
+			continue
+		}
+		anns = append(anns, a)
+	}
+	anns, capped := capAnnouncements(anns, opts.Max, opts.Logger)
+
+	results := append(runAll(ctx, opts, anns), invalid...)
+	return append(results, skippedResults(opts, capped, skipCapped)...), ctx.Err()
+}
+
+// AnnounceInterface announces source on the interface named ifName to
+// gateway. A nil source means the interface's first IPv4 address, and a nil
+// gateway the one in opts.Gateways or else the gateway of its subnet or its
+// default gateway, as AnnounceAll would choose. The error is set if the
+// announcement can't be made at all, for example ErrNoGateway; a failure to
+// send is in the Result.
+func AnnounceInterface(ctx context.Context, ifName string, source, gateway net.IP, opts Options) (Result, error) {
+	opts, err := prepare(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	opts = withVariant(ctx, opts)
+
+	iface, err := lookupInterface(ifName, opts.Logger)
+	if err != nil {
+		return Result{}, err
+	}
+	routes := func() ([]Route, []Route, error) { return loadRoutes(opts.Routes, opts.Logger) }
+	a, err := interfaceAnnouncement(opts, iface, source, gateway, routes)
+	if err != nil {
+		return Result{}, err
+	}
+	r := announce(ctx, opts, a)
+	notify(opts, r)
+	return r, nil
+}
+
+// interfaceAnnouncement returns the announcement of source on iface to
+// gateway for AnnounceInterface, choosing those that are nil from iface and
+// opts, or else from the IPv4 and IPv6 routes that routes returns.
+func interfaceAnnouncement(opts Options, iface Interface, source, gateway net.IP, routes func() ([]Route, []Route, error)) (announcement, error) {
+	ifName := iface.Name
+	if source == nil {
+		for _, addr := range iface.Addrs {
+			if ip, _, err := net.ParseCIDR(addr); err == nil && ip.To4() != nil {
+				source = ip
+				break
+			}
+		}
+		if source == nil {
+			return announcement{}, fmt.Errorf("%s has no IPv4 address", ifName)
+		}
+	}
+	if gateway == nil && source.To4() != nil {
+		gateway = opts.Gateways[ifName]
+		if opts.NoGateway {
+			gateway = source
+		}
+	}
+	if gateway == nil {
+		routes, routes6, err := routes()
+		if err != nil {
+			return announcement{}, err
+		}
+		if source.To4() == nil {
+			routes = routes6
+		}
+		routes = filterTable(routes, opts.Table)
+		gateway = first(defaultGateways(routes, opts.Logger)[ifName])
+		if _, ipnet, err := net.ParseCIDR(addrOf(iface, source)); err == nil {
+			gateway = first(subnetGateways(routes, ifName, ipnet, []net.IP{gateway}))
+			if gateway.IsUnspecified() && source.To4() != nil {
+				gateway = broadcastAddr(ipnet) // on-link default route
+			}
+		}
+		if gateway == nil {
+			return announcement{}, fmt.Errorf("%s: %w", ifName, ErrNoGateway)
+		}
+	}
+	return newAnnouncement(opts, iface, Pair{Interface: ifName, Source: source, Gateway: gateway})
+}
+
+// pairAnnouncement returns the announcement for p.
+func pairAnnouncement(opts Options, p Pair) (announcement, error) {
+	iface, err := lookupInterface(p.Interface, opts.Logger)
+	if err != nil {
+		return announcement{}, err
+	}
+	return newAnnouncement(opts, iface, p)
+}
+
+// newAnnouncement returns the announcement for p on iface, checking that it
+// can be made.
+func newAnnouncement(opts Options, iface Interface, p Pair) (announcement, error) {
+	if (p.Source.To4() == nil) != (p.Gateway.To4() == nil) {
+		return announcement{}, fmt.Errorf("source %s and gateway %s are different address families", p.Source, p.Gateway)
+	}
+	switch v4 := p.Source.To4() != nil; {
+	case v4 && !opts.Family.ipv4():
+		return announcement{}, fmt.Errorf("source %s is IPv4, which family %s doesn't announce", p.Source, opts.Family)
+	case !v4 && !opts.Family.ipv6():
+		return announcement{}, fmt.Errorf("source %s is IPv6, which family %s doesn't announce", p.Source, opts.Family)
+	case !v4 && opts.Ndsend == "":
+		return announcement{}, fmt.Errorf("source %s is IPv6, and there is no ndsend to announce it", p.Source)
+	}
+	if p.Source.To4() != nil && !gatewayAllowed(opts, p.Gateway) {
+		return announcement{}, fmt.Errorf("gateway %s is not allowed", p.Gateway)
+	}
+	if !iface.HasAddr(p.Source) && !p.Source.Equal(opts.AnnounceSource) {
+		return announcement{}, fmt.Errorf("source %s is not assigned to %s", p.Source, p.Interface)
+	}
+	return announcement{iface: iface, addr: addrOf(iface, p.Source), source: p.Source, gateway: p.Gateway}, nil
+}
+
+// lookupInterface returns the interface named name, whatever its flags.
+func lookupInterface(name string, logger *slog.Logger) (Interface, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return Interface{}, fmt.Errorf("interface %s: %w", name, err)
+	}
+	iface, err := describe(*ifi, logger)
+	if err != nil {
+		return Interface{}, fmt.Errorf("listing addresses of %s: %w", name, err)
+	}
+	return iface, nil
+}
+
+// addrOf returns the address of iface, in CIDR notation, that is ip, or ""
+// if there is none.
+func addrOf(iface Interface, ip net.IP) string {
+	for _, addr := range iface.Addrs {
+		if a, _, err := net.ParseCIDR(addr); err == nil && a.Equal(ip) {
+			return addr
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewAnnouncement(t *testing.T) {
+	iface := Interface{Index: 2, Name: "eth0", MAC: "02:00:00:00:00:01", Addrs: []string{"192.0.2.10/24", "2001:db8::10/64"}}
+	v4 := Pair{Interface: "eth0", Source: net.ParseIP("192.0.2.10"), Gateway: net.ParseIP("192.0.2.1")}
+	v6 := Pair{Interface: "eth0", Source: net.ParseIP("2001:db8::10"), Gateway: net.ParseIP("2001:db8::1")}
+	tests := []struct {
+		name    string
+		opts    Options
+		pair    Pair
+		wantErr string // empty if it should be announced
+	}{
+		{"IPv4", Options{Family: FamilyIPv4}, v4, ""},
+		{"IPv6", Options{Family: FamilyBoth, Ndsend: "ndsend"}, v6, ""},
+		{"IPv6 with family 4", Options{Family: FamilyIPv4, Ndsend: "ndsend"}, v6, "family 4 doesn't announce"},
+		{"IPv4 with family 6", Options{Family: FamilyIPv6, Ndsend: "ndsend"}, v4, "family 6 doesn't announce"},
+		{"IPv6 without ndsend", Options{Family: FamilyIPv6}, v6, "no ndsend"},
+		{"mixed families", Options{Family: FamilyBoth, Ndsend: "ndsend"}, Pair{Interface: "eth0", Source: v4.Source, Gateway: v6.Gateway}, "different address families"},
+		{"source not assigned", Options{Family: FamilyIPv4}, Pair{Interface: "eth0", Source: net.ParseIP("192.0.2.99"), Gateway: v4.Gateway}, "not assigned"},
+		{"gateway not allowed", Options{Family: FamilyIPv4, AllowGateways: []net.IP{net.ParseIP("192.0.2.254")}}, v4, "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := newAnnouncement(tt.opts, iface, tt.pair)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			case err != nil:
+				return
+			}
+			if a.addr == "" || !a.source.Equal(tt.pair.Source) || !a.gateway.Equal(tt.pair.Gateway) {
+				t.Errorf("got announcement of %s (%s) to %s", a.source, a.addr, a.gateway)
+			}
+		})
+	}
+}
+
+func TestInterfaceAnnouncement(t *testing.T) {
+	eth0 := ethernet(2, "eth0", "2001:db8::10/64", "192.0.2.10/24", "192.0.2.20/24")
+	routes := func(routes ...Route) func() ([]Route, []Route, error) {
+		return func() ([]Route, []Route, error) {
+			routes4, routes6 := splitFamilies(routes)
+			return routes4, routes6, nil
+		}
+	}
+	viaGateway := routes(defaultRoute("eth0", "192.0.2.1", 0), defaultRoute("eth1", "198.51.100.1", 0))
+	onLink := defaultRoute("eth0", "0.0.0.0", 0)
+	onLink.Flags = RTF_UP
+	tests := []struct {
+		name            string
+		opts            Options
+		iface           Interface
+		source, gateway string
+		routes          func() ([]Route, []Route, error)
+		want            string // source>gateway, or the error
+	}{
+		{"default gateway", Options{}, eth0, "", "", viaGateway, "192.0.2.10>192.0.2.1"},
+		{"given source", Options{}, eth0, "192.0.2.20", "", viaGateway, "192.0.2.20>192.0.2.1"},
+		{"given gateway", Options{}, eth0, "", "192.0.2.254", nil, "192.0.2.10>192.0.2.254"},
+		{"-gateways", Options{Gateways: map[string]net.IP{"eth0": net.ParseIP("192.0.2.253")}}, eth0, "", "", nil, "192.0.2.10>192.0.2.253"},
+		{"-no-gateway", Options{NoGateway: true}, eth0, "", "", nil, "192.0.2.10>192.0.2.10"},
+		{"on-link default route", Options{}, eth0, "", "", routes(onLink), "192.0.2.10>192.0.2.255"},
+		{"no gateway", Options{}, eth0, "", "", routes(defaultRoute("eth1", "198.51.100.1", 0)), "eth0: no gateway found"},
+		{"no IPv4 address", Options{}, ethernet(3, "eth1", "2001:db8::11/64"), "", "", viaGateway, "eth1 has no IPv4 address"},
+		{"IPv6", Options{Family: FamilyBoth, Ndsend: "ndsend"}, eth0, "2001:db8::10", "", routes(defaultRoute("eth0", "fe80::1", 0)), "2001:db8::10>fe80::1"},
+	}
+	for _, tt := range tests {
+		opts := testOptions(t, &fakeRunner{}, tt.opts)
+		routes := tt.routes
+		if routes == nil {
+			routes = func() ([]Route, []Route, error) {
+				t.Errorf("%s: routes read with a gateway known", tt.name)
+				return nil, nil, nil
+			}
+		}
+		a, err := interfaceAnnouncement(opts, tt.iface, net.ParseIP(tt.source), net.ParseIP(tt.gateway), routes)
+		got := a.source.String() + ">" + a.gateway.String()
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceAnnouncementSends(t *testing.T) {
+	r := &fakeRunner{}
+	opts := testOptions(t, r, Options{})
+	noRoutes := func() ([]Route, []Route, error) { return nil, nil, nil }
+	if _, err := interfaceAnnouncement(opts, ethernet(2, "eth0", "192.0.2.10/24"), nil, nil, noRoutes); !errors.Is(err, ErrNoGateway) {
+		t.Errorf("without routes got %v, want ErrNoGateway", err)
+	}
+
+	a, err := interfaceAnnouncement(opts, ethernet(2, "eth0", "192.0.2.10/24"), nil, net.ParseIP("192.0.2.1"), noRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := announce(context.Background(), opts, a); res.Err != nil || res.Interface != "eth0" {
+		t.Errorf("got result %+v", res)
+	}
+	if got, want := r.commands(), []string{"arping -U -c 1 -I eth0 -s 192.0.2.10 192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,486 @@
+package arpingall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+)
+
+// announcement is a single address to announce.
+type announcement struct {
+	iface   Interface
+	addr    string // CIDR the source came from
+	source  net.IP
+	gateway net.IP
+	via     string // bridge member to send on instead of iface
+
+	targetMAC net.HardwareAddr // unicast destination of native ARPs; nil for broadcast
+}
+
+// key identifies a's interface, source and gateway, which together make it
+// unique.
+func (a announcement) key() string {
+	return a.iface.Name + "|" + a.via + "|" + a.source.String() + "|" + a.gateway.String()
+}
+
+// subnet returns the subnet and gateway of a, which is the same for
+// announcements on interfaces sharing a segment. A link-local subnet, which
+// every link has, includes the interface name as its zone.
+func (a announcement) subnet() string {
+	subnet := a.addr
+	if _, ipnet, err := net.ParseCIDR(a.addr); err == nil {
+		subnet = ipnet.String()
+		if ipnet.IP.IsLinkLocalUnicast() {
+			subnet += "%" + a.iface.Name
+		}
+	}
+	return subnet + "|" + a.gateway.String()
+}
+
+// SkipKind says whether an address or announcement is skipped on purpose or
+// because it can't be made.
+type SkipKind int
+
+const (
+	NotSkipped SkipKind = iota
+	// SkipDeliberate is left out on purpose, by the options or as a
+	// duplicate of another announcement.
+	SkipDeliberate
+	// SkipUnannounceable should be announced but can't be, for example for
+	// lack of a gateway. Options.Strict counts IPv4 ones as failed.
+	SkipUnannounceable
+)
+
+// Planned is an announcement AnnounceAll would make, or an address or
+// interface it would skip.
+type Planned struct {
+	Interface string
+	Addr      string // CIDR the source comes from; empty for a skipped interface
+	Via       string // bridge member it would be sent on
+	SourceIP  net.IP
+	Gateway   net.IP
+	Skip      string   // why it would be skipped; empty if it would be announced
+	SkipKind  SkipKind // NotSkipped if it would be announced
+}
+
+// Plan works out what AnnounceAll would do with opts, including what it would
+// skip and why, without sending anything.
+func Plan(opts Options) ([]Planned, error) {
+	opts, err := prepare(opts)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, routes, routes6, neighbors, err := discoverAll(opts)
+	if err != nil {
+		return nil, err
+	}
+	planned := skippedInterfaces(opts.Filter)
+	for _, i := range ifaces {
+		if len(i.Addrs) == 0 {
+			// Otherwise it wouldn't be listed at all.
+			planned = append(planned, Planned{Interface: i.Name, Skip: skipNoAddrs, SkipKind: SkipDeliberate})
+		}
+	}
+	_, entries, err := plan(opts, ifaces, routes, routes6, neighbors)
+	if errors.Is(err, ErrNoGateway) {
+		err = nil // every entry says so
+	}
+	var last state
+	if opts.ChangedOnly {
+		last = loadState(opts.StateFile, opts.Logger)
+	}
+	announced := 0
+	for n := range entries {
+		if entries[n].Skip != "" {
+			continue
+		}
+		if contains(last[entries[n].Interface], entries[n].Addr) {
+			entries[n].Skip, entries[n].SkipKind = skipUnchanged, SkipDeliberate
+			continue
+		}
+		if announced++; opts.Max > 0 && announced > opts.Max {
+			entries[n].Skip, entries[n].SkipKind = skipCapped, SkipDeliberate
+		}
+	}
+	return append(planned, entries...), err
+}
+
+// plan works out which announcements to make for ifaces, given the IPv4 and
+// IPv6 routing tables and, with opts.RefreshNeighbors, the ARP cache. It also
+// returns every announcement and skipped address in order, for Plan.
+// Addresses that can't be announced are logged and skipped.
+func plan(opts Options, ifaces []Interface, routes, routes6 []Route, neighbors []Neighbor) ([]announcement, []Planned, error) {
+	dups := duplicateAddrs(ifaces)
+	dupIPs := make([]string, 0, len(dups))
+	for ip := range dups {
+		dupIPs = append(dupIPs, ip)
+	}
+	sort.Strings(dupIPs)
+	for _, ip := range dupIPs {
+		names := dups[ip]
+		if opts.Strict {
+			return nil, nil, fmt.Errorf("%w: %s on %s", ErrDuplicateAddress, ip, strings.Join(names, ", "))
+		}
+		opts.Logger.Warn("Address is assigned to more than one interface; their announcements will conflict", "addr", ip, "ifaces", names)
+	}
+
+	defaultRoutes := defaultGateways(routes, opts.Logger)
+	defaultRoutes6 := defaultGateways(routes6, opts.Logger)
+
+	var anns []announcement
+	var planned []Planned
+	var plannedAt []int // index in planned of each of anns
+	seen := make(map[string]bool)
+	duplicates := 0
+	skip := func(i Interface, addr string, kind SkipKind, level slog.Level, reason string) {
+		logSkip(opts, level, "Skipping address", "addr", addr, "iface", i.Name, "reason", reason)
+		planned = append(planned, Planned{Interface: i.Name, Addr: addr, Skip: reason, SkipKind: kind})
+	}
+	add := func(a announcement) {
+		p := Planned{Interface: a.iface.Name, Addr: a.addr, Via: a.via, SourceIP: a.source, Gateway: a.gateway}
+		switch {
+		case a.gateway != nil && (a.source.To4() == nil) != (a.gateway.To4() == nil):
+			logSkip(opts, slog.LevelWarn, "Skipping announcement because its gateway is of another address family", "source", a.source, "gateway", a.gateway, "iface", a.iface.Name)
+			p.Skip, p.SkipKind = "gateway of another address family", SkipUnannounceable
+		case !a.iface.HasAddr(a.source) && !a.source.Equal(opts.AnnounceSource):
+			logSkip(opts, slog.LevelWarn, "Skipping announcement because its source IP is not assigned to the interface", "source", a.source, "iface", a.iface.Name)
+			p.Skip, p.SkipKind = "source IP not assigned to interface", SkipUnannounceable
+		case a.source.To4() != nil && !gatewayAllowed(opts, a.gateway):
+			logSkip(opts, slog.LevelInfo, "Skipping announcement because its gateway isn't allowed", "gateway", a.gateway, "source", a.source, "iface", a.iface.Name)
+			p.Skip, p.SkipKind = "gateway not allowed", SkipDeliberate
+		case seen[a.key()]:
+			duplicates++
+			p.Skip, p.SkipKind = "duplicate", SkipDeliberate
+		case a.via != "" && !opts.Native && opts.Variant == VariantIputils:
+			// It would announce the member's MAC instead of the bridge's.
+			logSkip(opts, slog.LevelWarn, "Skipping bridge member because iputils arping can't set the sender MAC; use -native", "iface", a.iface.Name, "member", a.via)
+			p.Skip, p.SkipKind = "iputils arping can't send the bridge's MAC", SkipDeliberate
+		default:
+			seen[a.key()] = true
+			if opts.Native && a.source.To4() != nil {
+				a.targetMAC = targetMAC(opts, a, neighbors)
+			}
+			anns = append(anns, a)
+			plannedAt = append(plannedAt, len(planned))
+		}
+		planned = append(planned, p)
+	}
+	targetReachable, sourceLocal := false, false
+	noGateway := false
+	prefSeen := make(map[string]bool)
+	for _, i := range ifaces {
+		for _, addr := range i.Addrs {
+			ip, ipnet, err := net.ParseCIDR(addr)
+			if err != nil {
+				logSkip(opts, slog.LevelWarn, "Skipping address that isn't in CIDR notation", "addr", addr, "iface", i.Name, "err", err)
+				planned = append(planned, Planned{Interface: i.Name, Addr: addr, Skip: "not in CIDR notation", SkipKind: SkipUnannounceable})
+				continue
+			}
+			if ip.To4() == nil {
+				if !opts.Family.ipv6() {
+					skip(i, addr, SkipDeliberate, slog.LevelDebug, "only IPv4 is announced")
+					continue
+				}
+				if opts.Ndsend == "" {
+					skip(i, addr, SkipDeliberate, slog.LevelDebug, "IPv6 announcements are disabled")
+					continue
+				}
+				// Neighbor advertisements go to all nodes on the link, so a
+				// link-local address, which no route covers, doesn't need a
+				// gateway; its gateway, if any, is scoped to the interface.
+				gw := first(subnetGateways(routes6, i.Name, ipnet, defaultRoutes6[i.Name]))
+				if gw.IsUnspecified() {
+					gw = nil // on-link default route
+				}
+				if gw == nil && !ip.IsLinkLocalUnicast() && !opts.NoGateway {
+					skip(i, addr, SkipUnannounceable, slog.LevelInfo, "no default gateway")
+					noGateway = true
+					continue
+				}
+				add(announcement{iface: i, addr: addr, source: ip, gateway: gw})
+				continue
+			}
+
+			if !opts.Family.ipv4() {
+				skip(i, addr, SkipDeliberate, slog.LevelDebug, "only IPv6 is announced")
+				continue
+			}
+			gws := subnetGateways(routes, i.Name, ipnet, defaultRoutes[i.Name])
+			if opts.FirstGatewayOnly && len(gws) > 1 {
+				gws = gws[:1]
+			}
+			if override, ok := opts.Gateways[i.Name]; ok {
+				if !ipnet.Contains(override) {
+					skip(i, addr, SkipDeliberate, slog.LevelInfo, "gateway override is not on its subnet")
+					continue
+				}
+				gws = []net.IP{override}
+			}
+			if opts.NoGateway {
+				gws = []net.IP{nil} // the source, once it is known
+			} else if opts.Target != nil {
+				if !ipnet.Contains(opts.Target) {
+					skip(i, addr, SkipDeliberate, slog.LevelDebug, "target is not on its subnet")
+					continue
+				}
+				gws = []net.IP{opts.Target}
+				targetReachable = true
+			} else if opts.Broadcast {
+				gws = nil
+				if bcast := broadcastAddr(ipnet); bcast != nil {
+					gws = []net.IP{bcast}
+				}
+			}
+			if len(gws) == 0 {
+				skip(i, addr, SkipUnannounceable, slog.LevelInfo, "no default gateway")
+				noGateway = true
+				continue
+			}
+			addrIP := ip
+			for n, gw := range gws {
+				ip := addrIP
+				if gw.IsUnspecified() {
+					// An on-link default route has no gateway to announce to;
+					// announce to the whole subnet instead of to 0.0.0.0.
+					gw = broadcastAddr(ipnet)
+					if gw == nil {
+						skip(i, addr, SkipUnannounceable, slog.LevelInfo, "on-link default route and no broadcast address")
+						continue
+					}
+					opts.Logger.Debug("Announcing to the broadcast address for on-link default route", "gateway", gw, "addr", addr, "iface", i.Name)
+				}
+				if opts.SourceSelection != SourceAll && !opts.NoGateway {
+					// One announcement per gateway, from the address the
+					// policy picks.
+					key := i.Name + "|" + gw.String()
+					if prefSeen[key] {
+						skip(i, addr, SkipDeliberate, slog.LevelDebug, "gateway already announced from "+sourceDescription[opts.SourceSelection])
+						continue
+					}
+					prefSeen[key] = true
+					switch opts.SourceSelection {
+					case SourceLowest:
+						ip = lowestAddr(i, ipnet)
+					case SourcePrefSrc:
+						if src := preferredSource(routes, i.Name, gw); src != nil && i.HasAddr(src) {
+							ip = src
+						} else {
+							opts.Logger.Debug("No preferred source for gateway; using first address", "gateway", gw, "addr", addr, "iface", i.Name)
+						}
+					}
+				}
+				if opts.AnnounceSource != nil && ipnet.Contains(opts.AnnounceSource) {
+					opts.Logger.Debug("Announcing override source instead of address", "source", opts.AnnounceSource, "addr", addr, "iface", i.Name)
+					ip = opts.AnnounceSource
+					sourceLocal = true
+				}
+				if opts.NoGateway {
+					gw = ip
+				}
+				add(announcement{iface: i, addr: addr, source: ip, gateway: gw})
+				if opts.BridgeMembers {
+					for _, m := range i.BridgeMembers {
+						add(announcement{iface: i, addr: addr, source: ip, gateway: gw, via: m})
+					}
+				}
+				if opts.RefreshNeighbors && opts.Target == nil && n == 0 {
+					for _, nb := range neighbors {
+						if nb.Interface == i.Name && ipnet.Contains(nb.IP) && !containsIP(gws, nb.IP) && !nb.IP.Equal(ip) {
+							add(announcement{iface: i, addr: addr, source: ip, gateway: nb.IP})
+						}
+					}
+				}
+			}
+		}
+	}
+	if duplicates > 0 {
+		opts.Logger.Debug("Collapsed duplicate announcements", "duplicates", duplicates)
+	}
+	if opts.OncePerSubnet {
+		anns = oncePerSubnet(anns, func(n int, kept string) {
+			p := planned[plannedAt[n]]
+			logSkip(opts, slog.LevelInfo, "Suppressing announcement made on another interface in the same subnet", "iface", p.Interface, "source", p.SourceIP, "gateway", p.Gateway, "chosen", kept)
+			planned[plannedAt[n]].Skip = "subnet announced on " + kept
+			planned[plannedAt[n]].SkipKind = SkipDeliberate
+		})
+	}
+	if opts.Target != nil && !targetReachable {
+		return nil, planned, fmt.Errorf("target %s is not on any local subnet", opts.Target)
+	}
+	if opts.AnnounceSource != nil && !sourceLocal {
+		return nil, planned, fmt.Errorf("announce source %s is not on any local subnet", opts.AnnounceSource)
+	}
+	if noGateway && len(anns) == 0 {
+		if (!opts.Family.ipv4() || len(defaultRoutes) == 0) && (!opts.Family.ipv6() || len(defaultRoutes6) == 0) {
+			// Likely a minimal network namespace; say so once rather than
+			// failing as if every interface had lost its gateway.
+			opts.Logger.Warn("No default routes found; nothing to announce", "family", opts.Family)
+			return nil, planned, nil
+		}
+		return nil, planned, ErrNoGateway
+	}
+
+	return anns, planned, nil
+}
+
+// oncePerSubnet keeps, for each subnet and gateway, only the announcements on
+// one interface, the one whose name sorts first. suppress is called with the
+// index of each announcement dropped and the interface kept instead.
+func oncePerSubnet(anns []announcement, suppress func(n int, kept string)) []announcement {
+	chosen := make(map[string]string)
+	for _, a := range anns {
+		if c, ok := chosen[a.subnet()]; !ok || a.iface.Name < c {
+			chosen[a.subnet()] = a.iface.Name
+		}
+	}
+
+	var kept []announcement
+	for n, a := range anns {
+		if c := chosen[a.subnet()]; c != a.iface.Name {
+			suppress(n, c)
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// logSkip logs why an address or announcement is skipped at level, or at
+// debug level with opts.QuietSkips.
+func logSkip(opts Options, level slog.Level, msg string, args ...any) {
+	if opts.QuietSkips {
+		level = slog.LevelDebug
+	}
+	opts.Logger.Log(context.Background(), level, msg, args...)
+}
+
+// sourceDescription describes the address each SourceSelection picks, for
+// the skips of the others.
+var sourceDescription = map[SourceSelection]string{
+	SourceFirst:   "first address",
+	SourceLowest:  "lowest address",
+	SourcePrefSrc: "preferred source",
+}
+
+// lowestAddr returns the numerically lowest IPv4 address of i in subnet.
+func lowestAddr(i Interface, subnet *net.IPNet) net.IP {
+	var lowest net.IP
+	for _, addr := range i.Addrs {
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil || ip.To4() == nil || !subnet.Contains(ip) {
+			continue
+		}
+		if lowest == nil || bytes.Compare(ip.To4(), lowest.To4()) < 0 {
+			lowest = ip
+		}
+	}
+	return lowest
+}
+
+// duplicateAddrs maps every IPv4 address assigned to more than one of ifaces
+// to the names of those interfaces.
+func duplicateAddrs(ifaces []Interface) map[string][]string {
+	owners := make(map[string][]string)
+	for _, i := range ifaces {
+		for _, addr := range i.Addrs {
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil || ip.To4() == nil {
+				continue
+			}
+			if names := owners[ip.String()]; len(names) == 0 || names[len(names)-1] != i.Name {
+				owners[ip.String()] = append(names, i.Name)
+			}
+		}
+	}
+	for ip, names := range owners {
+		if len(names) < 2 {
+			delete(owners, ip)
+		}
+	}
+	return owners
+}
+
+// targetMAC returns the destination MAC of native announcements for a:
+// opts.TargetMAC, or with opts.TargetMACAuto the gateway's MAC from the ARP
+// cache, or nil to broadcast.
+func targetMAC(opts Options, a announcement, neighbors []Neighbor) net.HardwareAddr {
+	if !opts.TargetMACAuto {
+		return opts.TargetMAC
+	}
+	for _, n := range neighbors {
+		if n.Interface == a.iface.Name && n.IP.Equal(a.gateway) {
+			if mac, err := net.ParseMAC(n.MAC); err == nil {
+				return mac
+			}
+		}
+	}
+	opts.Logger.Warn("Gateway is not in the ARP cache; broadcasting instead", "gateway", a.gateway, "iface", a.iface.Name)
+	return nil
+}
+
+// subnetGateways returns the gateways of the default routes on iface that
+// lie inside subnet, lowest metric first, so that each address on a
+// multi-homed interface is announced to its own routers. It returns fallback
+// if there are none.
+func subnetGateways(routes []Route, iface string, subnet *net.IPNet, fallback []net.IP) []net.IP {
+	var matching []Route
+	for _, r := range routes {
+		if r.Interface == iface && isDefaultGateway(r) && r.Flags&RTF_UP != 0 && subnet.Contains(r.Gateway) {
+			matching = append(matching, r)
+		}
+	}
+	if len(matching) == 0 {
+		return fallback
+	}
+	return gatewaysByMetric(matching)
+}
+
+// first returns the first of ips, or nil if there are none.
+func first(ips []net.IP) net.IP {
+	if len(ips) == 0 {
+		return nil
+	}
+	return ips[0]
+}
+
+// broadcastAddr returns the directed broadcast address of the IPv4 subnet,
+// or nil for /31 and /32 subnets, which have none.
+func broadcastAddr(subnet *net.IPNet) net.IP {
+	ip := subnet.IP.To4()
+	if ip == nil || len(subnet.Mask) != net.IPv4len {
+		return nil
+	}
+	if ones, _ := subnet.Mask.Size(); ones >= 31 {
+		return nil
+	}
+	bcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		bcast[i] = ip[i] | ^subnet.Mask[i]
+	}
+	return bcast
+}
+
+// preferredSource returns the preferred source address of the route on iface
+// that reaches gw: its default route via gw, or else the route whose
+// destination contains gw. It returns nil if neither has one.
+func preferredSource(routes []Route, iface string, gw net.IP) net.IP {
+	var onLink net.IP
+	for _, r := range routes {
+		if r.Interface != iface || r.PrefSrc == nil {
+			continue
+		}
+		if isDefaultGateway(r) && r.Gateway.Equal(gw) {
+			return r.PrefSrc
+		}
+		dst := net.IPNet{IP: r.Destination, Mask: r.Mask}
+		if onLink == nil && !isDefault(r) && dst.Contains(gw) {
+			onLink = r.PrefSrc
+		}
+	}
+	return onLink
+}
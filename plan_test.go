@@ -0,0 +1,400 @@
+package arpingall
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// announced formats anns as "iface source>gateway", with " via member" for
+// bridge members.
+func announced(anns []announcement) []string {
+	var list []string
+	for _, a := range anns {
+		s := a.iface.Name + " " + a.source.String() + ">" + a.gateway.String()
+		if a.via != "" {
+			s += " via " + a.via
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// planFor plans announcements for ifaces and routes with opts, failing the
+// test on an error.
+func planFor(t *testing.T, opts Options, ifaces []Interface, routes []Route) ([]announcement, []Planned) {
+	t.Helper()
+	anns, planned, err := planning(testOptions(t, nil, opts), ifaces, routes)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return anns, planned
+}
+
+func TestPlanTwoSubnets(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24", "198.51.100.7/24")}
+	routes := []Route{defaultRoute("eth0", "192.0.2.1", 0), defaultRoute("eth0", "198.51.100.1", 10)}
+
+	anns, _ := planFor(t, Options{}, ifaces, routes)
+	want := []string{"eth0 192.0.2.10>192.0.2.1", "eth0 198.51.100.7>198.51.100.1"}
+	if got := announced(anns); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBroadcastAddr(t *testing.T) {
+	for cidr, want := range map[string]string{
+		"192.0.2.10/24":   "192.0.2.255",
+		"10.1.2.3/16":     "10.1.255.255",
+		"198.51.100.9/30": "198.51.100.11",
+		"192.0.2.10/31":   "<nil>",
+		"192.0.2.10/32":   "<nil>",
+		"2001:db8::1/64":  "<nil>",
+	} {
+		_, subnet, _ := net.ParseCIDR(cidr)
+		if got := broadcastAddr(subnet).String(); got != want {
+			t.Errorf("broadcastAddr(%s) = %s, want %s", cidr, got, want)
+		}
+	}
+}
+
+func TestPlanBroadcast(t *testing.T) {
+	anns, _ := planFor(t, Options{Broadcast: true}, threeInterfaces[:1], nil)
+	if got := announced(anns); !reflect.DeepEqual(got, []string{"eth0 192.0.2.10>192.0.2.255"}) {
+		t.Errorf("got %q, want the /24's broadcast address, with or without a default route", got)
+	}
+}
+
+func TestPlanFamily(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24", "2001:db8::10/64", "fe80::10/64")}
+	routes := []Route{defaultRoute("eth0", "192.0.2.1", 0), defaultRoute("eth0", "fe80::1", 0)}
+	v4 := "eth0 192.0.2.10>192.0.2.1"
+	v6 := []string{"eth0 2001:db8::10>fe80::1", "eth0 fe80::10>fe80::1"}
+	for _, tt := range []struct {
+		family Family
+		ndsend string
+		want   []string
+	}{
+		{FamilyIPv4, "ndsend", []string{v4}},
+		{FamilyIPv6, "ndsend", v6},
+		{FamilyBoth, "ndsend", append([]string{v4}, v6...)},
+		{FamilyBoth, "", []string{v4}}, // IPv6 disabled without ndsend
+	} {
+		anns, planned := planFor(t, Options{Family: tt.family, Ndsend: tt.ndsend}, ifaces, routes)
+		if got := announced(anns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("family %s, ndsend %q: got %q, want %q", tt.family, tt.ndsend, got, tt.want)
+		}
+		if skipped := len(planned) - len(anns); skipped != 3-len(tt.want) {
+			t.Errorf("family %s, ndsend %q: %d skipped, want %d", tt.family, tt.ndsend, skipped, 3-len(tt.want))
+		}
+	}
+}
+
+func TestPlanPrefSrc(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24", "192.0.2.20/24")}
+	route := defaultRoute("eth0", "192.0.2.1", 0)
+	route.PrefSrc = net.ParseIP("192.0.2.20")
+
+	anns, _ := planFor(t, Options{PrefSrc: true}, ifaces, []Route{route})
+	if got, want := announced(anns), []string{"eth0 192.0.2.20>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Without a preferred source, the first address is used.
+	route.PrefSrc = nil
+	anns, _ = planFor(t, Options{PrefSrc: true}, ifaces, []Route{route})
+	if got, want := announced(anns), []string{"eth0 192.0.2.10>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without prefsrc got %q, want %q", got, want)
+	}
+}
+
+func TestPlanSourceSelection(t *testing.T) {
+	// Listed neither in numeric order nor with the preferred source first.
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.30/24", "192.0.2.10/24", "192.0.2.20/24")}
+	route := defaultRoute("eth0", "192.0.2.1", 0)
+	route.PrefSrc = net.ParseIP("192.0.2.20")
+
+	for _, tt := range []struct {
+		sel  SourceSelection
+		want []string
+	}{
+		{SourceAll, []string{"eth0 192.0.2.30>192.0.2.1", "eth0 192.0.2.10>192.0.2.1", "eth0 192.0.2.20>192.0.2.1"}},
+		{SourceFirst, []string{"eth0 192.0.2.30>192.0.2.1"}},
+		{SourceLowest, []string{"eth0 192.0.2.10>192.0.2.1"}},
+		{SourcePrefSrc, []string{"eth0 192.0.2.20>192.0.2.1"}},
+	} {
+		anns, _ := planFor(t, Options{SourceSelection: tt.sel}, ifaces, []Route{route})
+		if got := announced(anns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestPlanMalformedAddress(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10", "192.0.2.300/24", "192.0.2.11/24")}
+	routes := []Route{defaultRoute("eth0", "192.0.2.1", 0)}
+
+	anns, planned := planFor(t, Options{SourceSelection: SourceAll}, ifaces, routes)
+	if got, want := announced(anns), []string{"eth0 192.0.2.11>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var skipped []string
+	for _, p := range planned {
+		if p.Skip != "" {
+			skipped = append(skipped, p.Addr+": "+p.Skip)
+		}
+	}
+	if want := []string{"192.0.2.10: not in CIDR notation", "192.0.2.300/24: not in CIDR notation"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got skips %q, want %q", skipped, want)
+	}
+}
+
+func TestPlanBridgeMembers(t *testing.T) {
+	br0 := ethernet(2, "br0", "192.0.2.10/24")
+	br0.BridgeMembers = []string{"eth0", "eth1"}
+	ifaces := []Interface{br0}
+	routes := []Route{defaultRoute("br0", "192.0.2.1", 0)}
+
+	for _, tt := range []struct {
+		members bool
+		want    []string
+	}{
+		{false, []string{"br0 192.0.2.10>192.0.2.1"}},
+		{true, []string{"br0 192.0.2.10>192.0.2.1", "br0 192.0.2.10>192.0.2.1 via eth0", "br0 192.0.2.10>192.0.2.1 via eth1"}},
+	} {
+		anns, _ := planFor(t, Options{BridgeMembers: tt.members, Variant: VariantHabets}, ifaces, routes)
+		if got := announced(anns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("BridgeMembers %t: got %q, want %q", tt.members, got, tt.want)
+		}
+	}
+
+	// iputils arping would send the member's MAC, so members are skipped.
+	anns, planned := planFor(t, Options{BridgeMembers: true}, ifaces, routes)
+	if got, want := announced(anns), []string{"br0 192.0.2.10>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("iputils: got %q, want %q", got, want)
+	}
+	for _, p := range planned {
+		if p.Via != "" && p.Skip != "iputils arping can't send the bridge's MAC" {
+			t.Errorf("iputils: member %s got skip %q", p.Via, p.Skip)
+		}
+	}
+}
+
+func TestPlanDuplicateTuple(t *testing.T) {
+	// The same address twice, once with another prefix length, gives the
+	// same announcement.
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24", "192.0.2.10/25", "192.0.2.10/24")}
+	routes := []Route{defaultRoute("eth0", "192.0.2.1", 0)}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	anns, planned := planFor(t, Options{SourceSelection: SourceAll, Logger: logger}, ifaces, routes)
+	if got, want := announced(anns), []string{"eth0 192.0.2.10>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	duplicates := 0
+	for _, p := range planned {
+		if p.Skip == "duplicate" {
+			duplicates++
+		}
+	}
+	if duplicates != 2 {
+		t.Errorf("got %d duplicates planned, want 2", duplicates)
+	}
+	if !strings.Contains(logs.String(), "Collapsed duplicate announcements") || !strings.Contains(logs.String(), "duplicates=2") {
+		t.Errorf("duplicates weren't logged:\n%s", logs.String())
+	}
+}
+
+func TestPlanLinkLocalGateway(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "2001:db8::10/64", "fe80::10/64")}
+	opts := Options{Family: FamilyIPv6, Ndsend: "ndsend"}
+
+	anns, _ := planFor(t, opts, ifaces, []Route{defaultRoute("eth0", "fe80::1", 0)})
+	if got, want := announced(anns), []string{"eth0 2001:db8::10>fe80::1", "eth0 fe80::10>fe80::1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Without a default route, the link-local address is still announced to
+	// all nodes on the link, but the global one has no gateway.
+	anns, planned := planFor(t, opts, ifaces, nil)
+	if len(anns) != 1 || !anns[0].source.Equal(net.ParseIP("fe80::10")) || anns[0].gateway != nil {
+		t.Errorf("without routes got %q, want only fe80::10 without a gateway", announced(anns))
+	}
+	for _, p := range planned {
+		if p.Addr == "2001:db8::10/64" && p.Skip != "no default gateway" {
+			t.Errorf("2001:db8::10 got skip %q, want no default gateway", p.Skip)
+		}
+	}
+}
+
+func TestPlanOncePerSubnet(t *testing.T) {
+	// bond0 and eth1 are on the same segment, with another address each;
+	// eth2 is elsewhere.
+	ifaces := []Interface{
+		ethernet(2, "eth1", "192.0.2.11/24"),
+		ethernet(3, "bond0", "192.0.2.10/24"),
+		ethernet(4, "eth2", "198.51.100.7/24"),
+	}
+	routes := []Route{defaultRoute("eth1", "192.0.2.1", 0), defaultRoute("bond0", "192.0.2.1", 0), defaultRoute("eth2", "198.51.100.1", 0)}
+
+	anns, _ := planFor(t, Options{}, ifaces, routes)
+	if len(anns) != 3 {
+		t.Errorf("without -once-per-subnet got %q, want all 3", announced(anns))
+	}
+
+	anns, planned := planFor(t, Options{OncePerSubnet: true}, ifaces, routes)
+	if got, want := announced(anns), []string{"bond0 192.0.2.10>192.0.2.1", "eth2 198.51.100.7>198.51.100.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, p := range planned {
+		if p.Interface == "eth1" && p.Skip != "subnet announced on bond0" {
+			t.Errorf("eth1 got skip %q, want subnet announced on bond0", p.Skip)
+		}
+	}
+}
+
+func TestPlanOncePerSubnetLinkLocal(t *testing.T) {
+	// Every link has fe80::/64, and often the same gateway address on it, so
+	// eth0 and eth1 don't share a segment.
+	ifaces := []Interface{ethernet(2, "eth0", "fe80::10/64"), ethernet(3, "eth1", "fe80::11/64")}
+	routes := []Route{defaultRoute("eth0", "fe80::1", 0), defaultRoute("eth1", "fe80::1", 0)}
+	opts := Options{Family: FamilyIPv6, Ndsend: "ndsend", OncePerSubnet: true}
+
+	anns, _ := planFor(t, opts, ifaces, routes)
+	if got, want := announced(anns), []string{"eth0 fe80::10>fe80::1", "eth1 fe80::11>fe80::1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPlanOnLinkDefault(t *testing.T) {
+	onLink := defaultRoute("eth0", "0.0.0.0", 0)
+	onLink.Flags = RTF_UP // no RTF_GATEWAY
+	routes := []Route{onLink}
+
+	if gws := defaultGateways(routes, discardLogger)["eth0"]; len(gws) != 1 || !gws[0].Equal(net.IPv4zero) {
+		t.Fatalf("got default gateways %v, want only 0.0.0.0", gws)
+	}
+
+	anns, planned := planFor(t, Options{SourceSelection: SourceAll}, []Interface{ethernet(2, "eth0", "192.0.2.10/24", "198.51.100.7/32")}, routes)
+	if got, want := announced(anns), []string{"eth0 192.0.2.10>192.0.2.255"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want the subnet broadcast rather than 0.0.0.0", got)
+	}
+	for _, p := range planned {
+		if p.Addr == "198.51.100.7/32" && p.Skip != "on-link default route and no broadcast address" {
+			t.Errorf("/32 got skip %q", p.Skip)
+		}
+	}
+}
+
+func TestPlanAllowGateways(t *testing.T) {
+	ifaces, routes := threeInterfaces[:2], threeRoutes[:2]
+	allowed := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("203.0.113.1")}
+
+	anns, planned := planFor(t, Options{AllowGateways: allowed}, ifaces, routes)
+	if got, want := announced(anns), []string{"eth0 192.0.2.10>192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, p := range planned {
+		if p.Interface == "eth1" && p.Skip != "gateway not allowed" {
+			t.Errorf("eth1 got skip %q, want gateway not allowed", p.Skip)
+		}
+	}
+
+	// An empty list allows every gateway.
+	if anns, _ := planFor(t, Options{}, ifaces, routes); len(anns) != 2 {
+		t.Errorf("without an allow-list got %q", announced(anns))
+	}
+}
+
+func TestPlanGatewayOverride(t *testing.T) {
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24"), ethernet(3, "eth1", "198.51.100.7/24", "203.0.113.5/24")}
+	routes := threeRoutes[:2]
+	// eth0's is overridden; eth1's is discovered, and the override isn't on
+	// its second subnet.
+	opts := Options{
+		SourceSelection: SourceAll,
+		Gateways: map[string]net.IP{
+			"eth0": net.ParseIP("192.0.2.254"),
+			"eth1": net.ParseIP("198.51.100.254"),
+		},
+	}
+
+	anns, planned := planFor(t, opts, ifaces, routes)
+	want := []string{"eth0 192.0.2.10>192.0.2.254", "eth1 198.51.100.7>198.51.100.254"}
+	if got := announced(anns); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, p := range planned {
+		if p.Addr == "203.0.113.5/24" && p.Skip != "gateway override is not on its subnet" {
+			t.Errorf("203.0.113.5 got skip %q", p.Skip)
+		}
+	}
+
+	// Interfaces without an override are discovered as before.
+	delete(opts.Gateways, "eth1")
+	anns, _ = planFor(t, opts, ifaces, routes)
+	want = []string{"eth0 192.0.2.10>192.0.2.254", "eth1 198.51.100.7>198.51.100.1", "eth1 203.0.113.5>198.51.100.1"}
+	if got := announced(anns); !reflect.DeepEqual(got, want) {
+		t.Errorf("with one override got %q, want %q", got, want)
+	}
+}
+
+func TestPlanDuplicateAddress(t *testing.T) {
+	// 192.0.2.10 is on both interfaces, once with another prefix length.
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24"), ethernet(3, "eth1", "198.51.100.7/24", "192.0.2.10/25")}
+	if got, want := duplicateAddrs(ifaces), map[string][]string{"192.0.2.10": {"eth0", "eth1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicateAddrs = %v, want %v", got, want)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	if anns, _ := planFor(t, Options{Logger: logger}, ifaces, threeRoutes[:2]); len(anns) == 0 {
+		t.Error("nothing announced despite the duplicate")
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "addr=192.0.2.10") {
+		t.Errorf("the duplicate wasn't warned about:\n%s", logs.String())
+	}
+
+	opts := testOptions(t, nil, Options{Strict: true})
+	_, _, err := planning(opts, ifaces, threeRoutes[:2])()
+	if !errors.Is(err, ErrDuplicateAddress) || !strings.Contains(err.Error(), "192.0.2.10 on eth0, eth1") {
+		t.Errorf("with Strict got %v, want ErrDuplicateAddress naming both interfaces", err)
+	}
+}
+
+func TestPlanQuietSkips(t *testing.T) {
+	// eth1 and eth2 have no default route.
+	for _, tt := range []struct {
+		quiet bool
+		level string
+	}{
+		{false, "level=INFO"},
+		{true, "level=DEBUG"},
+	} {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		_, planned := planFor(t, Options{QuietSkips: tt.quiet, Logger: logger}, threeInterfaces, threeRoutes[:1])
+
+		skips := 0
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if strings.Contains(line, "no default gateway") {
+				skips++
+				if !strings.Contains(line, tt.level) {
+					t.Errorf("QuietSkips %t: got %q, want %s", tt.quiet, line, tt.level)
+				}
+			}
+		}
+		if skips != 2 {
+			t.Errorf("QuietSkips %t: logged %d skips, want 2:\n%s", tt.quiet, skips, logs.String())
+		}
+		// They are still planned as skips, for the summary.
+		if n := len(planned); n != 3 {
+			t.Errorf("QuietSkips %t: got %d planned, want 3", tt.quiet, n)
+		}
+	}
+}
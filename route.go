@@ -0,0 +1,353 @@
+package arpingall
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locations of the kernel's IPv4 and IPv6 routing tables, which tests
+// replace.
+var (
+	routeFile  = "/proc/net/route"
+	route6File = "/proc/net/ipv6_route"
+)
+
+// Route flags, as found in the Flags column of /proc/net/route.
+const (
+	RTF_UP      = 0x0001 // route usable
+	RTF_GATEWAY = 0x0002 // destination is a gateway
+	RTF_REJECT  = 0x0200 // unreachable or blackhole
+)
+
+// Route sources for Options.Routes.
+const (
+	RoutesAuto    = "auto"    // best available for the platform
+	RoutesNetlink = "netlink" // GetRoutesNetlink (Linux)
+	RoutesProcfs  = "procfs"  // GetRoutes and GetRoutes6 (Linux)
+	RoutesNetstat = "netstat" // GetRoutesNetstat (macOS and BSD)
+)
+
+type Route struct {
+	Interface   string
+	Index       int // interface index; only set by GetRoutesNetlink
+	Destination net.IP
+	Gateway     net.IP // link-local gateways are scoped to Interface
+	Mask        net.IPMask
+	Flags       uint32
+	Metric      int
+	Table       int    // routing table id; 0 if unknown
+	PrefSrc     net.IP // preferred source address; only set by GetRoutesNetlink
+}
+
+// TableMain is the id of the main routing table, the only one in
+// /proc/net/route.
+const TableMain = 254
+
+// filterTable returns the routes in table, or all routes if table is 0.
+func filterTable(routes []Route, table int) []Route {
+	if table == 0 {
+		return routes
+	}
+	var kept []Route
+	for _, r := range routes {
+		if r.Table == table {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Parse IP in the hex format used by /proc/net/route and /proc/net/ipv6_route.
+// The kernel prints IPv4 addresses as the 32-bit integer they are in memory,
+// so in host byte order (reversed on little-endian hosts), and IPv6 addresses
+// in network byte order.
+func parseIP(str string) (net.IP, error) {
+	bytes, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+	switch len(bytes) {
+	case net.IPv4len:
+		binary.NativeEndian.PutUint32(bytes, binary.BigEndian.Uint32(bytes))
+	case net.IPv6len:
+		// Already in network byte order.
+	default:
+		return nil, fmt.Errorf("invalid address length %d: %s", len(bytes), str)
+	}
+	return net.IP(bytes), nil
+}
+
+func GetRoutes() ([]Route, error) {
+	return GetRoutesFrom(routeFile)
+}
+
+// GetRoutesFrom reads routes from a file in /proc/net/route format.
+func GetRoutesFrom(path string) ([]Route, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	routes := []Route{}
+
+	scanner := bufio.NewReader(file)
+	lineNum := 0
+	for {
+		line, err := scanner.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+		// The last line may lack a newline, in which case it comes back
+		// with io.EOF and still has to be parsed.
+		eof := err == io.EOF
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			if eof {
+				break
+			}
+			continue // blank, e.g. trailing newline
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("wrong number of fields (expected at least 8, got %d): %s", len(fields), line)
+		}
+		lineNum++
+		if lineNum == 1 {
+			continue // skip header
+		}
+		routes = append(routes, Route{})
+		route := &routes[len(routes)-1]
+		route.Interface = fields[0]
+		route.Table = TableMain
+		ip, err := parseIP(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		route.Destination = ip
+		ip, err = parseIP(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		route.Gateway = ip
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags %q: %w", fields[3], err)
+		}
+		route.Flags = uint32(flags)
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric %q: %w", fields[6], err)
+		}
+		route.Metric = metric
+		ip, err = parseIP(fields[7])
+		if err != nil {
+			return nil, err
+		}
+		route.Mask = net.IPMask(ip)
+		if eof {
+			break
+		}
+	}
+	return routes, nil
+}
+
+func GetRoutes6() ([]Route, error) {
+	return GetRoutes6From(route6File)
+}
+
+// GetRoutes6From reads routes from a file in /proc/net/ipv6_route format:
+//
+//	dest dest_plen src src_plen nexthop metric refcnt use flags iface
+func GetRoutes6From(path string) ([]Route, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	routes := []Route{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("wrong number of fields (expected at least 10, got %d): %s", len(fields), line)
+		}
+		var route Route
+		route.Interface = fields[9]
+		ip, err := parseIP(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		route.Destination = ip
+		plen, err := strconv.ParseUint(fields[1], 16, 8)
+		if err != nil || plen > 8*net.IPv6len {
+			return nil, fmt.Errorf("invalid prefix length %q", fields[1])
+		}
+		route.Mask = net.CIDRMask(int(plen), 8*net.IPv6len)
+		ip, err = parseIP(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		route.Gateway = ip
+		metric, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric %q: %w", fields[5], err)
+		}
+		route.Metric = int(metric)
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags %q: %w", fields[8], err)
+		}
+		route.Flags = uint32(flags)
+		routes = append(routes, route)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return routes, nil
+}
+
+// isDefault reports whether r is a default route (0.0.0.0/0 or ::/0), with or
+// without a gateway.
+func isDefault(r Route) bool {
+	if !r.Destination.IsUnspecified() {
+		return false
+	}
+	ones, _ := r.Mask.Size()
+	return ones == 0
+}
+
+// isDefaultGateway reports whether r is a default route via its Gateway.
+func isDefaultGateway(r Route) bool {
+	return isDefault(r) && r.Flags&RTF_GATEWAY != 0 && !r.Gateway.IsUnspecified()
+}
+
+// isOnLinkDefault reports whether r is an on-link default route, which sends
+// everything straight out of its interface and so has no gateway, unlike
+// unreachable and blackhole routes, which send nothing.
+func isOnLinkDefault(r Route) bool {
+	return isDefault(r) && r.Flags&(RTF_GATEWAY|RTF_REJECT) == 0
+}
+
+// DefaultRoutes maps each interface to the gateway of its lowest-metric IPv4
+// default route, which is 0.0.0.0 for an on-link default route.
+func DefaultRoutes() (map[string]net.IP, error) {
+	routes, _, err := loadRoutes(RoutesAuto, slog.Default())
+	if err != nil {
+		return nil, err
+	}
+
+	return firstGateways(defaultGateways(routes, slog.Default())), nil
+}
+
+// DefaultRoutes6 is like DefaultRoutes for IPv6. Hosts without IPv6 may have
+// no IPv6 routes at all, in which case the map is empty.
+func DefaultRoutes6() (map[string]net.IP, error) {
+	_, routes6, err := loadRoutes(RoutesAuto, slog.Default())
+	if err != nil {
+		return nil, err
+	}
+
+	return firstGateways(defaultGateways(routes6, slog.Default())), nil
+}
+
+// defaultGateways maps each interface to the gateways of its default routes
+// that are up, such as both routers of a redundant pair, lowest metric first.
+// Only routes via a gateway (RTF_GATEWAY) count, except that an on-link
+// default route gives an unspecified gateway, 0.0.0.0 or ::, for plan to
+// announce to the whole link instead. Each gateway is of the same family as
+// routes, so that IPv4 addresses are only announced to IPv4 gateways and
+// IPv6 addresses to IPv6 ones.
+func defaultGateways(routes []Route, logger *slog.Logger) map[string][]net.IP {
+	byIface := make(map[string][]Route)
+	for _, r := range routes {
+		if !isDefault(r) {
+			continue
+		}
+		switch {
+		case r.Flags&RTF_UP == 0:
+			logger.Debug("Ignoring default route that is down", "iface", r.Interface, "gateway", r.Gateway)
+			continue
+		case isOnLinkDefault(r):
+			r.Gateway = net.IPv6unspecified
+			if r.Destination.To4() != nil {
+				r.Gateway = net.IPv4zero.To4()
+			}
+		case !isDefaultGateway(r):
+			logger.Debug("Ignoring default route without a gateway", "iface", r.Interface, "flags", r.Flags)
+			continue
+		case (r.Gateway.To4() == nil) != (r.Destination.To4() == nil):
+			// An IPv4 route via an IPv6 next hop: its gateway can't be
+			// announced to from an IPv4 address, or the other way round.
+			logger.Debug("Ignoring default route via a gateway of another family", "iface", r.Interface, "gateway", r.Gateway)
+			continue
+		}
+		byIface[r.Interface] = append(byIface[r.Interface], r)
+	}
+
+	gateways := make(map[string][]net.IP)
+	for name, rs := range byIface {
+		gateways[name] = gatewaysByMetric(rs)
+	}
+	return gateways
+}
+
+// gatewaysByMetric returns the distinct gateways of routes, lowest metric
+// first. On a tie the route listed first wins, matching the kernel's own
+// preference.
+func gatewaysByMetric(routes []Route) []net.IP {
+	sorted := append([]Route(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Metric < sorted[j].Metric })
+	var gws []net.IP
+	for _, r := range sorted {
+		if !containsIP(gws, r.Gateway) {
+			gws = append(gws, r.Gateway)
+		}
+	}
+	return gws
+}
+
+// firstGateways maps each interface in gateways to its first gateway.
+func firstGateways(gateways map[string][]net.IP) map[string]net.IP {
+	first := make(map[string]net.IP, len(gateways))
+	for name, gws := range gateways {
+		first[name] = gws[0]
+	}
+	return first
+}
+
+func containsIP(list []net.IP, ip net.IP) bool {
+	for _, v := range list {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFamilies separates IPv4 from IPv6 routes.
+func splitFamilies(all []Route) (routes, routes6 []Route) {
+	for _, r := range all {
+		if r.Destination.To4() != nil {
+			routes = append(routes, r)
+		} else {
+			routes6 = append(routes6, r)
+		}
+	}
+	return routes, routes6
+}
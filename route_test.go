@@ -0,0 +1,258 @@
+package arpingall
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// routeHeader is the first line of /proc/net/route.
+const routeHeader = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT"
+
+// writeRoutes writes content to a file in a temporary directory and returns
+// its path.
+func writeRoutes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "route")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// skipBigEndian skips tests of /proc/net/route fixtures captured on a
+// little-endian host, whose IPv4 addresses a big-endian host reads reversed.
+func skipBigEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixture is from a little-endian host")
+	}
+}
+
+// routeString formats the parts of r that the route files give.
+func routeString(r Route) string {
+	ones, _ := r.Mask.Size()
+	return fmt.Sprintf("%s %s/%d via %s flags %#x metric %d", r.Interface, r.Destination, ones, r.Gateway, r.Flags, r.Metric)
+}
+
+// checkRoutes reports routes that differ from want, as routeString formats
+// them.
+func checkRoutes(t *testing.T, routes []Route, want []string) {
+	t.Helper()
+	if len(routes) != len(want) {
+		t.Errorf("got %d routes, want %d", len(routes), len(want))
+	}
+	for i := 0; i < len(routes) && i < len(want); i++ {
+		if got := routeString(routes[i]); got != want[i] {
+			t.Errorf("route %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestGetRoutesFrom(t *testing.T) {
+	skipBigEndian(t)
+	routes, err := GetRoutesFrom("testdata/route.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoutes(t, routes, []string{
+		"eth0 0.0.0.0/0 via 192.0.2.1 flags 0x3 metric 100",
+		"eth0 192.0.2.0/24 via 0.0.0.0 flags 0x1 metric 100",
+		"eth1 198.51.100.0/24 via 0.0.0.0 flags 0x1 metric 0",
+	})
+	for _, r := range routes {
+		if r.Table != TableMain {
+			t.Errorf("%s: got table %d, want main", routeString(r), r.Table)
+		}
+	}
+}
+
+func TestGetRoutesFromMissingFile(t *testing.T) {
+	routes, err := GetRoutesFrom(filepath.Join(t.TempDir(), "route"))
+	if err == nil {
+		t.Fatalf("got %d routes and no error from a missing file", len(routes))
+	}
+}
+
+func TestDefaultGatewaysByMetric(t *testing.T) {
+	skipBigEndian(t)
+	routes, err := GetRoutesFrom("testdata/route-metrics.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := defaultGateways(routes, discardLogger)["eth0"]
+	if len(got) != 2 || got[0].String() != "192.0.2.1" || got[1].String() != "192.0.2.254" {
+		t.Errorf("got gateways %v, want 192.0.2.1 (metric 100) before 192.0.2.254 (metric 200)", got)
+	}
+	if gw := firstGateways(defaultGateways(routes, discardLogger))["eth0"]; gw.String() != "192.0.2.1" {
+		t.Errorf("got first gateway %s, want 192.0.2.1", gw)
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	skipBigEndian(t)
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"010200C0", "192.0.2.1"},
+		{"00000000", "0.0.0.0"},
+		{"FD000000000000000000000000000001", "fd00::1"},
+		{"FE800000000000000000000000000001", "fe80::1"},
+	} {
+		ip, err := parseIP(tt.in)
+		if err != nil || ip.String() != tt.want {
+			t.Errorf("parseIP(%q) = %v, %v; want %s", tt.in, ip, err, tt.want)
+		}
+	}
+	for _, in := range []string{"0102", "010200C0FF", "ZZ0200C0", ""} {
+		if ip, err := parseIP(in); err == nil {
+			t.Errorf("parseIP(%q) = %v, want an error", in, ip)
+		}
+	}
+}
+
+func TestGetRoutesFromCRLF(t *testing.T) {
+	skipBigEndian(t)
+	routes, err := GetRoutesFrom("testdata/route-crlf.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoutes(t, routes, []string{
+		"eth0 0.0.0.0/0 via 192.0.2.1 flags 0x3 metric 0",
+		"eth0 192.0.2.0/24 via 0.0.0.0 flags 0x1 metric 0",
+	})
+}
+
+func TestGetRoutesFromNoFinalNewline(t *testing.T) {
+	skipBigEndian(t)
+	for _, tt := range []struct {
+		content string
+		want    []string
+	}{
+		// The first route used to be taken for the header.
+		{routeHeader + "\neth0\t00000000\t010200C0\t0003\t0\t0\t0\t00000000\t0\t0\t0", []string{
+			"eth0 0.0.0.0/0 via 192.0.2.1 flags 0x3 metric 0",
+		}},
+		// The last route used to be dropped at EOF.
+		{routeHeader + "\neth0\t00000000\t010200C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\neth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0", []string{
+			"eth0 0.0.0.0/0 via 192.0.2.1 flags 0x3 metric 0",
+			"eth0 192.0.2.0/24 via 0.0.0.0 flags 0x1 metric 0",
+		}},
+	} {
+		routes, err := GetRoutesFrom(writeRoutes(t, tt.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkRoutes(t, routes, tt.want)
+	}
+}
+
+func TestFilterTable(t *testing.T) {
+	main := defaultRoute("eth0", "192.0.2.1", 0)
+	policy := defaultRoute("eth0", "192.0.2.254", 0)
+	policy.Table = 100
+	routes := []Route{main, policy}
+
+	for _, tt := range []struct {
+		table int
+		want  []string
+	}{
+		{0, []string{"192.0.2.1", "192.0.2.254"}},
+		{TableMain, []string{"192.0.2.1"}},
+		{100, []string{"192.0.2.254"}},
+		{200, nil},
+	} {
+		var got []string
+		for _, gw := range defaultGateways(filterTable(routes, tt.table), discardLogger)["eth0"] {
+			got = append(got, gw.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("table %d: got gateways %v, want %v", tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestParseIPNativeEndian(t *testing.T) {
+	// The kernel prints an address in network byte order as a native
+	// integer, so the token differs between architectures.
+	for _, s := range []string{"192.0.2.1", "198.51.100.254", "10.0.0.0"} {
+		ip := net.ParseIP(s).To4()
+		token := fmt.Sprintf("%08X", binary.NativeEndian.Uint32(ip))
+		if got, err := parseIP(token); err != nil || !got.Equal(ip) {
+			t.Errorf("parseIP(%q) = %v, %v; want %s", token, got, err, s)
+		}
+	}
+}
+
+func TestDefaultGatewaysIgnoresDownRoute(t *testing.T) {
+	skipBigEndian(t)
+	routes, err := GetRoutesFrom("testdata/route-down.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 || routes[0].Flags&RTF_UP != 0 {
+		t.Fatalf("got %d routes, want 3 with the first down", len(routes))
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	// The route via 192.0.2.1 has the lower metric, but is down.
+	if gws := defaultGateways(routes, logger)["eth0"]; len(gws) != 1 || !gws[0].Equal(net.ParseIP("192.0.2.254")) {
+		t.Errorf("got gateways %v, want only 192.0.2.254", gws)
+	}
+	if !strings.Contains(logs.String(), "Ignoring default route that is down") || !strings.Contains(logs.String(), "gateway=192.0.2.1") {
+		t.Errorf("the down route wasn't logged:\n%s", logs.String())
+	}
+}
+
+func TestPlanTwoDefaultRoutes(t *testing.T) {
+	skipBigEndian(t)
+	// A VRRP pair: default routes via 192.0.2.1 (metric 100) and
+	// 192.0.2.254 (metric 200) on eth0.
+	routes, err := GetRoutesFrom("testdata/route-metrics.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifaces := []Interface{ethernet(2, "eth0", "192.0.2.10/24")}
+
+	for _, tt := range []struct {
+		firstOnly bool
+		want      []string
+	}{
+		{false, []string{"eth0 192.0.2.10>192.0.2.1", "eth0 192.0.2.10>192.0.2.254"}},
+		{true, []string{"eth0 192.0.2.10>192.0.2.1"}},
+	} {
+		anns, _ := planFor(t, Options{FirstGatewayOnly: tt.firstOnly}, ifaces, routes)
+		if got := announced(anns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FirstGatewayOnly %t: got %q, want %q", tt.firstOnly, got, tt.want)
+		}
+	}
+}
+
+func TestPlanHeaderOnlyRoutes(t *testing.T) {
+	routes, err := GetRoutesFrom("testdata/route-empty.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 0 {
+		t.Fatalf("got %d routes from a header, want none", len(routes))
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	opts := testOptions(t, nil, Options{Logger: logger})
+	anns, _, err := planning(opts, threeInterfaces, routes)()
+	if err != nil || len(anns) != 0 {
+		t.Fatalf("got %d announcements and error %v, want neither", len(anns), err)
+	}
+	if n := strings.Count(logs.String(), "level=WARN"); n != 1 || !strings.Contains(logs.String(), "No default routes found; nothing to announce") {
+		t.Errorf("got %d warnings, want one saying there are no routes:\n%s", n, logs.String())
+	}
+}
@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package arpingall
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// loadRoutes returns the IPv4 and IPv6 routes from source, one of the Routes*
+// constants. Only netstat is available here.
+func loadRoutes(source string, logger *slog.Logger) (routes, routes6 []Route, err error) {
+	switch source {
+	case "", RoutesAuto, RoutesNetstat:
+	default:
+		return nil, nil, fmt.Errorf("route source %q is not supported on this platform", source)
+	}
+
+	all, err := GetRoutesNetstat()
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, routes6 = splitFamilies(all)
+	return routes, routes6, nil
+}
@@ -0,0 +1,41 @@
+package arpingall
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// loadRoutes returns the IPv4 and IPv6 routes from source, one of the Routes*
+// constants.
+func loadRoutes(source string, logger *slog.Logger) (routes, routes6 []Route, err error) {
+	switch source {
+	case "", RoutesAuto:
+		all, err := GetRoutesNetlink()
+		if err == nil {
+			routes, routes6 = splitFamilies(all)
+			return routes, routes6, nil
+		}
+		logger.Debug("Can't dump routes over netlink; falling back to procfs", "err", err)
+	case RoutesNetlink:
+		all, err := GetRoutesNetlink()
+		if err != nil {
+			return nil, nil, err
+		}
+		routes, routes6 = splitFamilies(all)
+		return routes, routes6, nil
+	case RoutesProcfs:
+	default:
+		return nil, nil, fmt.Errorf("unknown route source %q", source)
+	}
+
+	routes, err = GetRoutes()
+	if err != nil {
+		return nil, nil, err
+	}
+	routes6, err = GetRoutes6()
+	if err != nil {
+		// Hosts without IPv6 have no route file.
+		logger.Debug("Can't read IPv6 routes", "err", err)
+	}
+	return routes, routes6, nil
+}
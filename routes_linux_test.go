@@ -0,0 +1,50 @@
+package arpingall
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnnounceAllRouteReadError(t *testing.T) {
+	defer func(path string) { routeFile = path }(routeFile)
+	routeFile = filepath.Join(t.TempDir(), "route")
+
+	if _, _, err := loadRoutes(RoutesProcfs, discardLogger); err == nil {
+		t.Error("loadRoutes: no error for a missing route file")
+	}
+	r := &fakeRunner{}
+	results, err := AnnounceAllContext(context.Background(), Options{Routes: RoutesProcfs, Variant: VariantIputils, Runner: r, Logger: discardLogger})
+	if err == nil {
+		t.Errorf("AnnounceAllContext: no error for a missing route file, and %d results", len(results))
+	}
+	if cmds := r.commands(); len(cmds) > 0 {
+		t.Errorf("ran %q without routes", cmds)
+	}
+}
+
+func TestCacheRefreshRoutes(t *testing.T) {
+	skipBigEndian(t)
+	defer func(path, path6 string) { routeFile, route6File = path, path6 }(routeFile, route6File)
+	routeFile, route6File = "testdata/route.txt", filepath.Join(t.TempDir(), "ipv6_route")
+
+	c := &Cache{}
+	opts := Options{Routes: RoutesProcfs, Cache: c, Logger: discardLogger}
+	_, routes, _, err := discover(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("got %d routes from route.txt, want 3", len(routes))
+	}
+
+	// The cache doesn't read the routes again until told they changed.
+	routeFile = "testdata/route-metrics.txt"
+	if _, routes, _, _ = discover(opts); len(routes) != 3 {
+		t.Errorf("got %d routes from the cache, want the 3 cached", len(routes))
+	}
+	c.Refresh("eth0")
+	if _, routes, _, _ = discover(opts); len(routes) != 3 || routes[0].Metric != 200 {
+		t.Errorf("after Refresh got %d routes, want the 3 from route-metrics.txt", len(routes))
+	}
+}
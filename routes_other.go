@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package arpingall
+
+import (
+	"errors"
+	"log/slog"
+)
+
+func loadRoutes(source string, logger *slog.Logger) (routes, routes6 []Route, err error) {
+	return nil, nil, errors.New("reading routes is not supported on this platform")
+}
@@ -0,0 +1,87 @@
+package arpingall
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Runner runs the external commands that send announcements, returning their
+// standard output and standard error. A command that ran and exited
+// unsuccessfully should return an *exec.ExitError or *ErrArpingFailed.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// StreamRunner is a Runner that can also copy a command's standard output and
+// standard error to w as they are written. Options.Stream needs one.
+type StreamRunner interface {
+	Runner
+	RunStream(ctx context.Context, w io.Writer, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// execRunner is the default Runner, which runs commands with os/exec.
+type execRunner struct{}
+
+func (r execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	return r.RunStream(ctx, io.Discard, name, args...)
+}
+
+func (execRunner) RunStream(ctx context.Context, w io.Writer, name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = io.MultiWriter(&stdout, w)
+	cmd.Stderr = io.MultiWriter(&stderr, w)
+	// Don't wait forever for children of a killed command holding its output
+	// open.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// prefixWriter writes each line written to it to w, prefixed with prefix.
+// Flush writes a final line that didn't end in a newline. It is safe for
+// concurrent use, as by os/exec copying stdout and stderr to it at once.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.write(b)
+}
+
+func (p *prefixWriter) write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			p.partial = append(p.partial, b...)
+			break
+		}
+		line := append(append([]byte(p.prefix), p.partial...), b[:i+1]...)
+		p.partial = p.partial[:0]
+		if _, err := p.w.Write(line); err != nil {
+			return n - len(b), err
+		}
+		b = b[i+1:]
+	}
+	return n, nil
+}
+
+func (p *prefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.partial) == 0 {
+		return nil
+	}
+	_, err := p.write([]byte("\n"))
+	return err
+}
@@ -0,0 +1,92 @@
+package arpingall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &prefixWriter{w: &buf, prefix: "eth0: "}
+	for _, s := range []string{"ARPING 192.0.2.1\nSent 1 ", "probes\n", "Received 0 response(s)"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "eth0: ARPING 192.0.2.1\neth0: Sent 1 probes\neth0: Received 0 response(s)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunStreamPrefixesBothStreams(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	var buf bytes.Buffer
+	w := &prefixWriter{w: &buf, prefix: "eth0: "}
+	script := `for i in 1 2 3 4 5 6 7 8; do echo out$i; echo err$i >&2; done`
+	stdout, stderr, err := execRunner{}.RunStream(context.Background(), w, "sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if n := strings.Count(string(stdout), "\n"); n != 8 {
+		t.Errorf("stdout has %d lines, want 8", n)
+	}
+	if n := strings.Count(string(stderr), "\n"); n != 8 {
+		t.Errorf("stderr has %d lines, want 8", n)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	sort.Strings(lines)
+	var want []string
+	for _, stream := range []string{"err", "out"} {
+		for i := 1; i <= 8; i++ {
+			want = append(want, "eth0: "+stream+string(rune('0'+i)))
+		}
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got lines\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAnnounceCapturesStderr(t *testing.T) {
+	arping := filepath.Join(t.TempDir(), "arping")
+	script := "#!/bin/sh\necho 'ARPING 192.0.2.1'\necho 'arping: Interface \"eth0\" is down' >&2\nexit 2\n"
+	if err := os.WriteFile(arping, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	opts := testOptions(t, execRunner{}, Options{Arping: arping, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	results, _ := announceAll(context.Background(), opts, planning(opts, threeInterfaces[:1], threeRoutes[:1]))
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	r := results[0]
+	if r.Output != "ARPING 192.0.2.1\n" || r.Stderr != "arping: Interface \"eth0\" is down\n" {
+		t.Errorf("got stdout %q, stderr %q", r.Output, r.Stderr)
+	}
+	var failed *ErrArpingFailed
+	if !errors.As(r.Err, &failed) || failed.ExitCode != 2 {
+		t.Fatalf("got error %v, want an *ErrArpingFailed with exit code 2", r.Err)
+	}
+	if !strings.Contains(r.Err.Error(), `Interface "eth0" is down`) {
+		t.Errorf("error %q doesn't include stderr", r.Err)
+	}
+	if !strings.Contains(logs.String(), `is down`) {
+		t.Errorf("stderr wasn't logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,89 @@
+package arpingall
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// skipUnchanged is why ChangedOnly leaves an address alone.
+const skipUnchanged = "unchanged since the last run"
+
+// state is what ChangedOnly remembers between runs: the addresses, in CIDR
+// notation, announced on each interface.
+type state map[string][]string
+
+// loadState reads the state file at path. A missing or corrupt file is
+// logged to logger and is an empty state, so that everything is announced.
+func loadState(path string, logger *slog.Logger) state {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn("Can't read state file; announcing everything", "path", path, "err", err)
+		}
+		return state{}
+	}
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		logger.Warn("Ignoring corrupt state file; announcing everything", "path", path, "err", err)
+		return state{}
+	}
+	return s
+}
+
+// save writes s to path, replacing the old file only once the new one is
+// complete.
+func (s state) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// splitUnchanged separates the announcements of addresses that s already
+// records from the rest.
+func splitUnchanged(anns []announcement, s state) (changed, unchanged []announcement) {
+	for _, a := range anns {
+		if contains(s[a.iface.Name], a.addr) {
+			unchanged = append(unchanged, a)
+		} else {
+			changed = append(changed, a)
+		}
+	}
+	return changed, unchanged
+}
+
+// nextState returns the state to save after a run with results: every
+// address left unchanged or announced without any failure. Addresses that
+// failed or weren't reached are announced again next time, and those
+// skipped for other reasons, such as having no gateway, aren't recorded.
+func nextState(results Results) state {
+	failed := make(map[[2]string]bool)
+	for _, r := range results {
+		if r.Err != nil || r.Skipped == skipCapped {
+			failed[[2]string{r.Interface, r.Addr}] = true
+		}
+	}
+	s := state{}
+	for _, r := range results {
+		if r.Skipped != "" && r.Skipped != skipUnchanged {
+			continue
+		}
+		if r.Addr == "" || failed[[2]string{r.Interface, r.Addr}] || contains(s[r.Interface], r.Addr) {
+			continue
+		}
+		s[r.Interface] = append(s[r.Interface], r.Addr)
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package arpingall
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	run := func(ifaces []Interface) int {
+		t.Helper()
+		r := &fakeRunner{}
+		opts := testOptions(t, r, Options{ChangedOnly: true, StateFile: path, SourceSelection: SourceAll})
+		if _, err := announceAll(context.Background(), opts, planning(opts, ifaces, threeRoutes)); err != nil {
+			t.Fatal(err)
+		}
+		return len(r.commands())
+	}
+
+	if n := run(threeInterfaces); n != 3 {
+		t.Errorf("first run: announced %d, want all 3", n)
+	}
+	if n := run(threeInterfaces); n != 0 {
+		t.Errorf("second run: announced %d, want none", n)
+	}
+	changed := append([]Interface(nil), threeInterfaces...)
+	changed[1] = ethernet(3, "eth1", "198.51.100.7/24", "198.51.100.8/24")
+	if n := run(changed); n != 1 {
+		t.Errorf("after adding an address: announced %d, want only it", n)
+	}
+
+	// A corrupt state file announces everything again.
+	if err := os.WriteFile(path, []byte("{eth0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n := run(changed); n != 4 {
+		t.Errorf("with a corrupt state file: announced %d, want all 4", n)
+	}
+}
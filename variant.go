@@ -0,0 +1,110 @@
+package arpingall
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Variant identifies an arping implementation. The two common ones take
+// different flags for the same things.
+type Variant int
+
+const (
+	VariantUnknown Variant = iota
+	VariantIputils         // iputils arping: -U/-A, -I iface, -s source
+	VariantHabets          // Thomas Habets' arping: -U/-P, -i iface, -S source
+)
+
+func (v Variant) String() string {
+	switch v {
+	case VariantIputils:
+		return "iputils"
+	case VariantHabets:
+		return "habets"
+	}
+	return "unknown"
+}
+
+// DetectVariant runs arping -h and classifies its usage text.
+func DetectVariant(ctx context.Context, arping string) Variant {
+	return detectVariant(ctx, execRunner{}, arping)
+}
+
+// detectVariant is DetectVariant with r running arping.
+func detectVariant(ctx context.Context, r Runner, arping string) Variant {
+	// Some versions exit non-zero for -h, so only the output matters. Usage
+	// goes to stdout or stderr depending on the version.
+	stdout, stderr, _ := r.Run(ctx, arping, "-h")
+	return classifyHelp(string(stdout) + string(stderr))
+}
+
+// classifyHelp classifies arping's usage text.
+func classifyHelp(help string) Variant {
+	switch {
+	case strings.Contains(help, "Habets"):
+		return VariantHabets
+	case strings.Contains(help, "iputils"),
+		strings.Contains(help, "-I device"),
+		strings.Contains(help, "-I <device>"):
+		return VariantIputils
+	}
+	return VariantUnknown
+}
+
+// arpingArgs returns the arping arguments announcing source to target on
+// iface for variant v.
+func arpingArgs(v Variant, mode Mode, count, iface, source, target string) []string {
+	if v == VariantHabets {
+		args := []string{"-U"}
+		if mode == ModeReply {
+			args = append(args, "-P")
+		}
+		return append(args, "-c", count, "-i", iface, "-S", source, target)
+	}
+
+	flag := "-U"
+	if mode == ModeReply {
+		flag = "-A"
+	}
+	return []string{flag, "-c", count, "-I", iface, "-s", source, target}
+}
+
+// dadArgs returns the arping arguments asking once whether any other host
+// has source on iface, sending from 0.0.0.0 as duplicate address detection
+// does so that nobody's cache is changed.
+func dadArgs(v Variant, iface, source string) []string {
+	if v == VariantHabets {
+		return []string{"-0", "-c", "1", "-i", iface, source}
+	}
+	return []string{"-D", "-c", "1", "-I", iface, source}
+}
+
+var (
+	iputilsReceived = regexp.MustCompile(`Received (\d+) response`)
+	habetsReceived  = regexp.MustCompile(`(\d+) packets received`)
+)
+
+// dadConflict reports whether the output of arping run with dadArgs counts
+// any replies, meaning that another host has the address. ok is false if the
+// output has no count.
+func dadConflict(v Variant, output string) (conflict, ok bool) {
+	re := iputilsReceived
+	if v == VariantHabets {
+		re = habetsReceived
+	}
+	m := re.FindStringSubmatch(output)
+	if m == nil {
+		return false, false
+	}
+	return m[1] != "0", true
+}
+
+// verifyArgs returns the arping arguments asking for target's MAC from source
+// on iface once, which exit successfully only if it replies.
+func verifyArgs(v Variant, iface, source, target string) []string {
+	if v == VariantHabets {
+		return []string{"-c", "1", "-i", iface, "-S", source, target}
+	}
+	return []string{"-c", "1", "-I", iface, "-s", source, target}
+}
@@ -0,0 +1,114 @@
+package arpingall
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestArpingArgsMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode Mode
+		want []string
+	}{
+		{ModeUpdate, []string{"-U", "-c", "1", "-I", "eth0", "-s", "192.0.2.10", "192.0.2.1"}},
+		{ModeReply, []string{"-A", "-c", "1", "-I", "eth0", "-s", "192.0.2.10", "192.0.2.1"}},
+	} {
+		if got := arpingArgs(VariantIputils, tt.mode, "1", "eth0", "192.0.2.10", "192.0.2.1"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mode %s: got %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDetectVariant(t *testing.T) {
+	for _, tt := range []struct {
+		help   string
+		stderr bool // where the variant prints its usage
+		want   Variant
+	}{
+		{"testdata/arping-iputils-help.txt", true, VariantIputils},
+		{"testdata/arping-habets-help.txt", false, VariantHabets},
+		{"", false, VariantUnknown},
+	} {
+		help := ""
+		if tt.help != "" {
+			b, err := os.ReadFile(tt.help)
+			if err != nil {
+				t.Fatal(err)
+			}
+			help = string(b)
+		}
+		r := &fakeRunner{run: func(context.Context, []string) (string, string, error) {
+			// Both exit non-zero for -h.
+			if tt.stderr {
+				return "", help, &ErrArpingFailed{ExitCode: 2}
+			}
+			return help, "", &ErrArpingFailed{ExitCode: 1}
+		}}
+		if got := detectVariant(context.Background(), r, "arping"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.help, got, tt.want)
+		}
+		if got := r.commands(); len(got) != 1 || got[0] != "arping -h" {
+			t.Errorf("ran %q, want arping -h", got)
+		}
+	}
+}
+
+func TestWithVariantFamily(t *testing.T) {
+	// arping isn't run, even to ask for its help, when only IPv6 is
+	// announced.
+	for _, tt := range []struct {
+		family Family
+		want   []string
+	}{
+		{FamilyIPv4, []string{"arping -h"}},
+		{FamilyBoth, []string{"arping -h"}},
+		{FamilyIPv6, nil},
+	} {
+		r := &fakeRunner{}
+		opts := testOptions(t, r, Options{Family: tt.family})
+		opts.Variant = VariantUnknown
+		withVariant(context.Background(), opts)
+		if got := r.commands(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("family %s: ran %q, want %q", tt.family, got, tt.want)
+		}
+	}
+}
+
+func TestArpingArgsVariant(t *testing.T) {
+	for _, tt := range []struct {
+		v    Variant
+		mode Mode
+		want []string
+	}{
+		{VariantIputils, ModeUpdate, []string{"-U", "-c", "3", "-I", "eth0", "-s", "192.0.2.10", "192.0.2.1"}},
+		{VariantHabets, ModeUpdate, []string{"-U", "-c", "3", "-i", "eth0", "-S", "192.0.2.10", "192.0.2.1"}},
+		{VariantHabets, ModeReply, []string{"-U", "-P", "-c", "3", "-i", "eth0", "-S", "192.0.2.10", "192.0.2.1"}},
+	} {
+		if got := arpingArgs(tt.v, tt.mode, "3", "eth0", "192.0.2.10", "192.0.2.1"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: got %q, want %q", tt.v, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDADConflict(t *testing.T) {
+	for _, tt := range []struct {
+		v                Variant
+		output           string
+		conflict, counts bool
+	}{
+		{VariantIputils, "ARPING 192.0.2.10 from 0.0.0.0 eth0\nSent 1 probes (1 broadcast(s))\nReceived 0 response(s)\n", false, true},
+		{VariantIputils, "ARPING 192.0.2.10 from 0.0.0.0 eth0\nUnicast reply from 192.0.2.10 [02:00:00:00:09:09]  0.701ms\nSent 1 probes (1 broadcast(s))\nReceived 1 response(s)\n", true, true},
+		{VariantHabets, "--- 192.0.2.10 statistics ---\n1 packets transmitted, 0 packets received, 100% unanswered (0 extra)\n", false, true},
+		{VariantHabets, "--- 192.0.2.10 statistics ---\n1 packets transmitted, 1 packets received,   0% unanswered (0 extra)\n", true, true},
+		// Each variant's count isn't the other's.
+		{VariantHabets, "Received 1 response(s)\n", false, false},
+		{VariantIputils, "arping: socket: Operation not permitted\n", false, false},
+	} {
+		conflict, ok := dadConflict(tt.v, tt.output)
+		if conflict != tt.conflict || ok != tt.counts {
+			t.Errorf("%s %q: got conflict %t, ok %t, want %t, %t", tt.v, tt.output, conflict, ok, tt.conflict, tt.counts)
+		}
+	}
+}
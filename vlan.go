@@ -0,0 +1,26 @@
+package arpingall
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VLAN describes an 802.1Q VLAN sub-interface.
+type VLAN struct {
+	ID     int    // VLAN id, 1-4094
+	Parent string // interface the tagged frames go out on, e.g. eth0
+}
+
+// vlanFromName guesses VLAN information from the parent.id naming convention
+// used by vconfig and most distributions, e.g. eth0.100.
+func vlanFromName(name string) (VLAN, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 {
+		return VLAN{}, false
+	}
+	id, err := strconv.Atoi(name[i+1:])
+	if err != nil || id < 1 || id > 4094 {
+		return VLAN{}, false
+	}
+	return VLAN{ID: id, Parent: name[:i]}, true
+}
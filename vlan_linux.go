@@ -0,0 +1,39 @@
+package arpingall
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// vlanConfigFile lists VLAN sub-interfaces while the 8021q module is loaded.
+const vlanConfigFile = "/proc/net/vlan/config"
+
+// lookupVLAN reports whether the interface named name is a VLAN
+// sub-interface, and its id and parent, from the kernel's VLAN table.
+func lookupVLAN(name string) (VLAN, bool) {
+	file, err := os.Open(vlanConfigFile)
+	if err != nil {
+		// Without the 8021q module there are no VLAN interfaces.
+		return VLAN{}, false
+	}
+	defer file.Close()
+
+	// VLAN Dev name    | VLAN ID
+	// Name-Type: VLAN_NAME_TYPE_RAW_PLUS_VID_NO_PAD
+	// eth0.100       | 100  | eth0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) != 3 || strings.TrimSpace(fields[0]) != name {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			break
+		}
+		return VLAN{ID: id, Parent: strings.TrimSpace(fields[2])}, true
+	}
+	return VLAN{}, false
+}
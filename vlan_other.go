@@ -0,0 +1,9 @@
+//go:build !linux
+
+package arpingall
+
+// lookupVLAN reports whether the interface named name is a VLAN
+// sub-interface, going by its name.
+func lookupVLAN(name string) (VLAN, bool) {
+	return vlanFromName(name)
+}
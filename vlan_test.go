@@ -0,0 +1,24 @@
+package arpingall
+
+import "testing"
+
+func TestVLANFromName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		vlan VLAN
+		ok   bool
+	}{
+		{"eth0.100", VLAN{ID: 100, Parent: "eth0"}, true},
+		{"bond0.4094", VLAN{ID: 4094, Parent: "bond0"}, true},
+		{"br.lan.7", VLAN{ID: 7, Parent: "br.lan"}, true},
+		{"eth0", VLAN{}, false},
+		{"eth0.0", VLAN{}, false},
+		{"eth0.4095", VLAN{}, false},
+		{"eth0.dmz", VLAN{}, false},
+		{".100", VLAN{}, false},
+	} {
+		if vlan, ok := vlanFromName(tt.name); vlan != tt.vlan || ok != tt.ok {
+			t.Errorf("vlanFromName(%q) = %+v, %t; want %+v, %t", tt.name, vlan, ok, tt.vlan, tt.ok)
+		}
+	}
+}
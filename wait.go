@@ -0,0 +1,41 @@
+package arpingall
+
+import (
+	"context"
+	"time"
+)
+
+// waitPoll is how often Options.Wait looks again for something to announce.
+// Tests shorten it.
+var waitPoll = time.Second
+
+// awaitAnnouncements calls find, which discovers and plans a run, until it
+// finds something to announce or, after opts.Wait, gives up and returns
+// what it found last. Interfaces may still be coming up at boot, so errors
+// are retried too. It stops early when ctx is done.
+func awaitAnnouncements(ctx context.Context, opts Options, find func() ([]announcement, []Planned, error)) ([]announcement, []Planned, error) {
+	deadline := time.Now().Add(opts.Wait)
+	for polls := 0; ; polls++ {
+		anns, planned, err := find()
+		remaining := time.Until(deadline)
+		if len(anns) > 0 || remaining <= 0 {
+			if polls > 0 && len(anns) == 0 {
+				opts.Logger.Warn("Still nothing to announce; giving up waiting", "wait", opts.Wait)
+			}
+			return anns, planned, err
+		}
+		if polls == 0 {
+			logger := opts.Logger
+			if err != nil {
+				logger = logger.With("err", err)
+			}
+			logger.Info("Nothing to announce yet; waiting for interfaces", "wait", opts.Wait)
+		}
+		if !sleep(ctx, min(waitPoll, remaining)) {
+			return nil, planned, ctx.Err()
+		}
+		if opts.Cache != nil {
+			opts.Cache.RefreshAll()
+		}
+	}
+}
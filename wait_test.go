@@ -0,0 +1,62 @@
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// shortWaitPoll makes Options.Wait poll every millisecond for the rest of t.
+func shortWaitPoll(t *testing.T) {
+	old := waitPoll
+	waitPoll = time.Millisecond
+	t.Cleanup(func() { waitPoll = old })
+}
+
+func TestAwaitAnnouncements(t *testing.T) {
+	shortWaitPoll(t)
+	opts := testOptions(t, &fakeRunner{}, Options{Wait: time.Minute})
+	// The interfaces have no addresses until the third poll.
+	polls := 0
+	find := func() ([]announcement, []Planned, error) {
+		polls++
+		ifaces := []Interface{ethernet(2, "eth0")}
+		if polls >= 3 {
+			ifaces = threeInterfaces[:1]
+		}
+		return planning(opts, ifaces, threeRoutes[:1])()
+	}
+	anns, _, err := awaitAnnouncements(context.Background(), opts, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 || len(anns) != 1 || anns[0].source.String() != "192.0.2.10" {
+		t.Errorf("got %d announcements after %d polls, want eth0's after 3", len(anns), polls)
+	}
+}
+
+func TestAwaitAnnouncementsGivesUp(t *testing.T) {
+	shortWaitPoll(t)
+	opts := testOptions(t, &fakeRunner{}, Options{Wait: 20 * time.Millisecond})
+	polls := 0
+	nothing := func() ([]announcement, []Planned, error) {
+		polls++
+		return nil, nil, nil
+	}
+	anns, _, err := awaitAnnouncements(context.Background(), opts, nothing)
+	if err != nil || len(anns) != 0 {
+		t.Errorf("got %d announcements, err %v, want none", len(anns), err)
+	}
+	if polls < 2 {
+		t.Errorf("polled %d times before giving up", polls)
+	}
+
+	// Cancelling stops the wait.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts.Wait = time.Minute
+	if _, _, err := awaitAnnouncements(ctx, opts, nothing); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after cancelling, want context.Canceled", err)
+	}
+}
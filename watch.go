@@ -0,0 +1,98 @@
+package arpingall
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// watchDebounce is how long link and address changes must settle before
+// Watch re-announces, so that a burst of events triggers a single run.
+const watchDebounce = 500 * time.Millisecond
+
+// linkChange is a change to the interface with index index, as reported by
+// subscribe.
+type linkChange struct {
+	index int
+	// lost is set if the interface went down, lost an address or was
+	// removed, which only needs it rediscovered, not announced.
+	lost bool
+	// all is set instead of index if changes were missed, so that
+	// everything has to be rediscovered and announced.
+	all bool
+}
+
+// Watch announces once and then again whenever an interface comes up or
+// gains an address, until ctx is done. The results of each run are passed to
+// report. Interfaces that go down or lose an address are rediscovered by the
+// next run, so that an address moved to another host isn't announced again.
+// It returns nil once ctx is done, or an error if it can no longer tell when
+// interfaces change. It is only supported on Linux.
+func Watch(ctx context.Context, opts Options, report func(Results, error)) error {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	// Subscribe before the first run so that no change is missed.
+	events, readErr, err := subscribe(ctx, opts.Logger)
+	if err != nil {
+		return err
+	}
+
+	if opts.Cache == nil {
+		opts.Cache = &Cache{}
+	}
+	report(AnnounceAllContext(ctx, opts))
+	debounce(ctx, events, watchDebounce, func(changes []linkChange) {
+		gained := false
+		for _, c := range changes {
+			if c.all {
+				opts.Cache.RefreshAll()
+				gained = true
+				continue
+			}
+			ifi, err := net.InterfaceByIndex(c.index)
+			if err != nil {
+				// Gone, or renamed since; we can't tell which it was.
+				opts.Cache.RefreshAll()
+			} else {
+				opts.Cache.Refresh(ifi.Name)
+			}
+			gained = gained || !c.lost
+		}
+		if gained {
+			report(AnnounceAllContext(ctx, opts))
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return readErr() // events was closed
+}
+
+// debounce collects changes from events and calls fn with them once no new
+// event has arrived for delay. It returns when ctx is done or events is
+// closed.
+func debounce(ctx context.Context, events <-chan linkChange, delay time.Duration, fn func(changes []linkChange)) {
+	var pending []linkChange
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-events:
+			if !ok {
+				return
+			}
+			pending = append(pending, change)
+			timer.Reset(delay)
+		case <-timer.C:
+			changes := pending
+			pending = nil
+			fn(changes)
+		}
+	}
+}
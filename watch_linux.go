@@ -0,0 +1,123 @@
+package arpingall
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// Netlink multicast groups, from <linux/rtnetlink.h>.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// subscribe listens for link and address changes on a netlink socket. It
+// sends each change until ctx is done or reading the socket fails, then
+// closes the socket and the channel. readErr then returns why reading
+// failed, or nil if ctx is done.
+func subscribe(ctx context.Context, logger *slog.Logger) (events <-chan linkChange, readErr func() error, err error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open netlink socket: %w", err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, nil, fmt.Errorf("bind netlink socket: %w", err)
+	}
+	// Non-blocking so that reads go through the runtime poller and Close
+	// interrupts them.
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+	sock := os.NewFile(uintptr(fd), "netlink")
+
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	changes := make(chan linkChange)
+	var failed error
+	send := func(c linkChange) bool {
+		select {
+		case changes <- c:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(changes)
+		buf := make([]byte, os.Getpagesize())
+		for {
+			n, err := sock.Read(buf)
+			if errors.Is(err, syscall.ENOBUFS) {
+				// The kernel dropped changes that didn't fit in the
+				// socket's buffer, as in a burst during a long run.
+				logger.Warn("Missed interface changes; rediscovering everything", "err", err)
+				if !send(linkChange{all: true}) {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					failed = fmt.Errorf("read netlink socket: %w", err)
+				}
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				logger.Warn("Can't parse netlink message", "err", err)
+				continue
+			}
+			for _, change := range linkChanges(msgs) {
+				if !send(change) {
+					return
+				}
+			}
+		}
+	}()
+	// Only called once changes is closed, after failed is set.
+	return changes, func() error { return failed }, nil
+}
+
+// linkChanges returns the interface changes msgs report: links that are up
+// (RTM_NEWLINK with IFF_UP) or gained an address (RTM_NEWADDR), and links
+// that went down (RTM_NEWLINK without IFF_UP), were removed (RTM_DELLINK) or
+// lost an address (RTM_DELADDR).
+func linkChanges(msgs []syscall.NetlinkMessage) []linkChange {
+	var changes []linkChange
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			// struct ifinfomsg: family, pad, type, index, flags, change
+			if len(m.Data) < syscall.SizeofIfInfomsg {
+				continue
+			}
+			index := int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+			flags := binary.NativeEndian.Uint32(m.Data[8:12])
+			lost := m.Header.Type == syscall.RTM_DELLINK || flags&syscall.IFF_UP == 0
+			changes = append(changes, linkChange{index: index, lost: lost})
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+			// struct ifaddrmsg: family, prefixlen, flags, scope, index
+			if len(m.Data) < syscall.SizeofIfAddrmsg {
+				continue
+			}
+			index := int(binary.NativeEndian.Uint32(m.Data[4:8]))
+			changes = append(changes, linkChange{index: index, lost: m.Header.Type == syscall.RTM_DELADDR})
+		}
+	}
+	return changes
+}
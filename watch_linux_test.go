@@ -0,0 +1,47 @@
+package arpingall
+
+import (
+	"encoding/binary"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// linkMessage returns an RTM_NEWLINK or RTM_DELLINK message for the
+// interface with the given index and flags.
+func linkMessage(typ uint16, index int, flags uint32) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(data[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(data[8:12], flags)
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: typ}, Data: data}
+}
+
+// addrMessage returns an RTM_NEWADDR or RTM_DELADDR message for the
+// interface with the given index.
+func addrMessage(typ uint16, index int) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfAddrmsg)
+	binary.NativeEndian.PutUint32(data[4:8], uint32(index))
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: typ}, Data: data}
+}
+
+func TestLinkChanges(t *testing.T) {
+	msgs := []syscall.NetlinkMessage{
+		linkMessage(syscall.RTM_NEWLINK, 2, syscall.IFF_UP|syscall.IFF_BROADCAST),
+		linkMessage(syscall.RTM_NEWLINK, 3, syscall.IFF_BROADCAST),
+		linkMessage(syscall.RTM_DELLINK, 4, 0),
+		addrMessage(syscall.RTM_NEWADDR, 5),
+		addrMessage(syscall.RTM_DELADDR, 6),
+		{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWROUTE}, Data: make([]byte, syscall.SizeofRtMsg)},
+		{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWLINK}, Data: []byte{0, 0}}, // truncated
+	}
+	want := []linkChange{
+		{index: 2},
+		{index: 3, lost: true},
+		{index: 4, lost: true},
+		{index: 5},
+		{index: 6, lost: true},
+	}
+	if got := linkChanges(msgs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
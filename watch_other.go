@@ -0,0 +1,13 @@
+//go:build !linux
+
+package arpingall
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+func subscribe(ctx context.Context, logger *slog.Logger) (<-chan linkChange, func() error, error) {
+	return nil, nil, errors.New("watching for interface changes is only supported on Linux")
+}
@@ -0,0 +1,72 @@
+package arpingall
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan linkChange)
+	calls := make(chan []linkChange, 10)
+	done := make(chan struct{})
+	go func() {
+		debounce(ctx, events, 50*time.Millisecond, func(changes []linkChange) { calls <- changes })
+		close(done)
+	}()
+
+	// A burst is delivered as one call.
+	for _, c := range []linkChange{{index: 2}, {index: 3, lost: true}, {index: 2}} {
+		events <- c
+	}
+	select {
+	case got := <-calls:
+		want := []linkChange{{index: 2}, {index: 3, lost: true}, {index: 2}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("first call: got %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("burst not delivered")
+	}
+
+	// A later event is a call of its own.
+	events <- linkChange{all: true}
+	select {
+	case got := <-calls:
+		if want := []linkChange{{all: true}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("second call: got %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second event not delivered")
+	}
+
+	close(events)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("debounce didn't return once events was closed")
+	}
+	if len(calls) != 0 {
+		t.Errorf("%d more calls, want none", len(calls))
+	}
+}
+
+func TestDebounceStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan linkChange, 1)
+	events <- linkChange{index: 2}
+	done := make(chan struct{})
+	go func() {
+		debounce(ctx, events, time.Hour, func([]linkChange) { t.Error("called after cancel") })
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("debounce didn't return once ctx was done")
+	}
+}